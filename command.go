@@ -90,8 +90,12 @@ func cmdLs(ss *saveFileSelector) (err error) {
 	if err != nil {
 		return
 	}
+	return printSaveList(ss.NormalizedPath, saveEntry)
+}
+
+// print the list of save entries with the path and the game title
+func printSaveList(path string, saveEntry []*saveEntry) (err error) {
 
-	// TODO: show comments if cfg.verbose is set
 	// TODO: terminal-aligned texts
 
 	title := ""
@@ -104,17 +108,35 @@ func cmdLs(ss *saveFileSelector) (err error) {
 		title = ie.Title
 	}
 
-	fmt.Printf("%s", ss.NormalizedPath)
+	fmt.Printf("%s", path)
 	if title != "" {
 		fmt.Printf(" %s", title)
 	}
 	fmt.Println()
 
+	// show tags, comments and protection in verbose mode
+	showTags, showComment, showProtected := false, false, false
+	if cfg.verbose {
+		for _, en := range saveEntry {
+			showTags = showTags || len(en.Tags) > 0
+			showComment = showComment || en.Comment != ""
+			showProtected = showProtected || en.Protected
+		}
+	}
+
 	lines := make([]string, 0)
-	lines = append(lines, // label
-		//"id\000savetime\000playtime\000char\000title\000map",
-		"id\000savetime\000playtime\000char\000gold\000map",
-	)
+	label := "id\000savetime\000playtime\000char\000gold\000map"
+	//label := "id\000savetime\000playtime\000char\000title\000map"
+	if showProtected {
+		label += "\000protected"
+	}
+	if showTags {
+		label += "\000tags"
+	}
+	if showComment {
+		label += "\000comment"
+	}
+	lines = append(lines, label)
 	for _, en := range saveEntry {
 		ie, e := en.indexEntry()
 		if e != nil {
@@ -129,10 +151,24 @@ func cmdLs(ss *saveFileSelector) (err error) {
 			//playtime = playtime[:5] // truncate ":second"
 			playtime = playtime[0:2] + "h" + playtime[3:5] + "m" // hh:mm:ss
 		}
-		lines = append(lines, fmt.Sprintf(
+		line := fmt.Sprintf(
 			"#%d\000%s\000[%s]\000%d\000%d\000%s",
 			en.Id, ts, playtime, charcount, ie.Gold, ie.MapName,
-		))
+		)
+		if showProtected {
+			if en.Protected {
+				line += "\000yes"
+			} else {
+				line += "\000"
+			}
+		}
+		if showTags {
+			line += "\000" + strings.Join(en.Tags, ",")
+		}
+		if showComment {
+			line += "\000" + en.Comment
+		}
+		lines = append(lines, line)
 	}
 	printAlignedLines(lines, "\000")
 
@@ -149,41 +185,47 @@ func cmdRm(ss *saveFileSelector) (err error) {
 
 	// select non-deleting entires
 	removeCount := 0
-	ss.ResetId()
 	newSave := make([]*saveEntry, 0)
-	nextId, removing := ss.NextId()
+	removed := make([]*saveEntry, 0)
 	for _, e := range entries {
-		if e.Id == nextId {
+		if ss.selects(e.Id) {
 			// remove ID matched; skip without append to the new entry
+			err = ss.checkProtected(e, "remove")
+			if err != nil {
+				return
+			}
 			if cfg.verbose {
 				fmt.Printf("removing %s\n", ss.displayPath(e.Id))
 			}
-			nextId, removing = ss.NextId()
+			removed = append(removed, e)
 			removeCount++
 			continue
 		}
-		if !removing || e.Id < nextId {
-			// keep the savedata
-			newSave = append(newSave, e)
-			continue
-		}
-		for nextId < e.Id && removing { // get the next remove ID
-			nextId, removing = ss.NextId()
-		}
+		// keep the savedata
+		newSave = append(newSave, e)
 	}
 
-	// save to file
-	err = ss.writeSaveToPath(newSave, cfg.rawJson, cfg.prettyJson)
+	// save to file, moving removed entries to the trash
+	t := newFileTransaction()
+	defer t.discard()
+	for _, e := range removed {
+		t.moveToTrash(saveDir(ss.NormalizedPath, ss.IsRpgMvSave), ss.displayPath(e.Id), e, true)
+	}
+	err = ss.stageSaveToPath(t, newSave, cfg.rawJson, cfg.prettyJson)
 	if err != nil {
 		return
 	}
 	if ss.IsRpgMvSave {
-		// delete move source files
-		err = removeUnusedRpgMvSave(ss.NormalizedPath, newSave)
+		// delete removed savefiles
+		err = removeUnusedRpgMvSave(t, ss.NormalizedPath, newSave)
 		if err != nil {
 			return
 		}
 	}
+	err = t.commit()
+	if err != nil {
+		return
+	}
 
 	if cfg.verbose {
 		fmt.Printf("%d saves removed\n", removeCount)
@@ -191,27 +233,80 @@ func cmdRm(ss *saveFileSelector) (err error) {
 	return
 }
 
+// convert save entry list to map of id=>*saveEntry
+func mkEntryMap(save []*saveEntry) map[int]*saveEntry {
+	sm := make(map[int]*saveEntry)
+	for _, e := range save {
+		sm[e.Id] = e
+	}
+	return sm
+}
+
+// convert map of id=>*saveEntry to save entry list sorted by id
+func sortedEntries(sm map[int]*saveEntry) []*saveEntry {
+	save := make([]*saveEntry, 0, len(sm))
+	for _, e := range sm {
+		save = append(save, e)
+	}
+	sort.Slice(save, func(i, j int) bool { return save[i].Id < save[j].Id })
+	return save
+}
+
 // copy savedata.
 func cmdCp(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 
 	// read all savedata at dest savefile
 	destEntry, _ := dest.readSaveAtPath(false, true)
+	destM := mkEntryMap(destEntry)
+	slotLimit, slotSource := dest.maxSavefiles()
 
 	// merge src savefiles into the dest savefile
 	dest.ResetId()
-	newSave := make([]*saveEntry, 0)
 	copyCount := 0
+	type renamed struct {
+		en      *saveEntry
+		id      int // the conflicting ID
+		srcPath string
+	}
+	renames := make([]renamed, 0) // entries placed in free slots after the others
+	copyEntry := func(en *saveEntry, id int, srcPath string) error {
+		err := dest.checkSlotLimit(id, slotLimit, slotSource)
+		if err != nil {
+			return err
+		}
+		// copy a source entry to dest
+		if cfg.verbose {
+			fmt.Printf("copying %s to %s\n", srcPath, dest.displayPath(id))
+		}
+		en.Id = id
+		en.Protected = false // a copy is not protected
+		stampComment(en)
+		destM[id] = en
+		copyCount++
+		return nil
+	}
 	for _, ss := range src {
 		var srcEntry []*saveEntry
 		srcEntry, err = ss.readSaveAtPath(false, false)
 		if err != nil {
 			return
 		}
+		// gaps are meaningful only for increasing IDs
+		keepGap := cfg.keepGap && ss.isIncreasing() && dest.isIncreasing()
+
+		// copy in the order written in the ID list
+		if keepGap {
+			srcEntry = ss.orderEntries(srcEntry)
+		} else {
+			// a listed ID without an entry leaves its destination ID unused
+			srcEntry = ss.pairEntries(srcEntry)
+		}
+
 		prevId := 0
 		for _, en := range srcEntry {
 			var nextId int
 			var ok bool
-			if cfg.keepGap {
+			if keepGap {
 				for prevId < en.Id {
 					nextId, ok = dest.NextId()
 					prevId++
@@ -220,50 +315,51 @@ func cmdCp(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 				nextId, ok = dest.NextId()
 				prevId = nextId
 			}
+			if en == nil {
+				// no entry at the listed ID
+				continue
+			}
 
 			if !ok {
 				err = fmt.Errorf("too many source savefiles")
 				return
 			}
-			for len(destEntry) > 0 && destEntry[0].Id < nextId {
-				// keep the entries that not contained in the overwrite id list
-				newSave = append(newSave, destEntry[0])
-				destEntry = destEntry[1:]
-			}
-			if len(destEntry) > 0 && destEntry[0].Id == nextId {
+			if existing, exists := destM[nextId]; exists {
 				// duplicated ID
-				overwrite := false
-				if cfg.force {
-					overwrite = true
-				} else {
-					// show an overwrite prompt
-					overwrite = promptYN(fmt.Sprintf("Overwrite %s with %s? (y/N) ", dest.displayPath(nextId), ss.displayPath(en.Id)), false)
+				var newId int
+				var write bool
+				newId, write, err = resolveConflict(dest, nextId, existing, en, ss.displayPath(en.Id))
+				if err != nil {
+					return
 				}
-				if !overwrite {
+				if !write {
 					// keep the old entry
-					newSave = append(newSave, destEntry[0])
-					destEntry = destEntry[1:]
 					continue
 				}
-				// overwriting
-				destEntry = destEntry[1:] // ignore the current existing entry
+				if newId == idFreeSlot {
+					renames = append(renames, renamed{en, nextId, ss.displayPath(en.Id)})
+					continue
+				}
 			}
-			// copy a source entry to dest
-			if cfg.verbose {
-				fmt.Printf("copying %s to %s\n", ss.displayPath(en.Id), dest.displayPath(nextId))
+			err = copyEntry(en, nextId, ss.displayPath(en.Id))
+			if err != nil {
+				return
 			}
-			en.Id = nextId
-			newSave = append(newSave, en)
-			copyCount++
 		}
 	}
-	if len(destEntry) > 0 {
-		// store leftover save entries
-		newSave = append(newSave, destEntry...)
+	for _, r := range renames {
+		id := nextFreeId(r.id, func(id int) bool {
+			_, used := destM[id]
+			return used
+		})
+		err = copyEntry(r.en, id, r.srcPath)
+		if err != nil {
+			return
+		}
 	}
 
 	// save to file
-	err = dest.writeSaveToPath(newSave, cfg.rawJson, cfg.prettyJson)
+	err = dest.writeSaveToPath(sortedEntries(destM), cfg.rawJson, cfg.prettyJson)
 	if err != nil {
 		return
 	}
@@ -277,15 +373,6 @@ func cmdCp(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 // move savedata between files.
 func cmdMv(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 
-	// convert save entry list to map of id=>*saveEntry
-	mkMap := func(save []*saveEntry) map[int]*saveEntry {
-		sm := make(map[int]*saveEntry)
-		for _, e := range save {
-			sm[e.Id] = e
-		}
-		return sm
-	}
-
 	// all savedata
 	saveFiles := make(map[string]map[int]*saveEntry)
 
@@ -294,14 +381,36 @@ func cmdMv(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 
 	// read all savedata at dest savefile
 	destEntry, _ := dest.readSaveAtPath(false, true)
-	destM := mkMap(destEntry)
+	destM := mkEntryMap(destEntry)
 	saveFiles[dest.NormalizedPath] = destM
+	slotLimit, slotSource := dest.maxSavefiles()
 
 	// merge src savefiles into the dest savefile
 	dest.ResetId()
 
 	newSave := make([]*saveEntry, 0) // map of id -> saveEntry map to be added to dest
 	moveCount := 0
+	type renamed struct {
+		se      *saveEntry
+		id      int // the conflicting ID
+		srcPath string
+	}
+	renames := make([]renamed, 0) // entries placed in free slots after the others
+	moveEntry := func(se *saveEntry, id int, srcPath string) error {
+		err := dest.checkSlotLimit(id, slotLimit, slotSource)
+		if err != nil {
+			return err
+		}
+		if cfg.verbose {
+			fmt.Printf("moving %s to %s\n", srcPath, dest.displayPath(id))
+		}
+		se.Id = id
+		stampComment(se)
+		newSave = append(newSave, se)
+		delete(destM, id) // remove the overwritten entry
+		moveCount++
+		return nil
+	}
 
 	for _, ss := range src {
 
@@ -315,18 +424,24 @@ func cmdMv(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 		// check if the save file is already in the cache list
 		srcM, ok := saveFiles[ss.NormalizedPath]
 		if !ok {
-			srcM = mkMap(srcEntry)
+			srcM = mkEntryMap(srcEntry)
 			srcFiles[ss.NormalizedPath] = ss
 		}
 		maxSrcId := 0
-		for _, e := range srcM {
-			if e.Id > maxSrcId {
-				maxSrcId = e.Id
+		srcSnapshot := make(map[int]*saveEntry) // source entries before moving; srcM may be modified when moving within a file
+		for id, e := range srcM {
+			if id > maxSrcId {
+				maxSrcId = id
 			}
+			srcSnapshot[id] = e
 		}
+		moved := make(map[int]bool)
 
 		sameFile := (ss.NormalizedPath == dest.NormalizedPath)
 
+		// gaps are meaningful only for increasing IDs
+		keepGap := cfg.keepGap && ss.isIncreasing() && dest.isIncreasing()
+
 		// copy individual savefiles
 		ss.ResetId()
 		prevId := -1
@@ -334,26 +449,48 @@ func cmdMv(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 			stepCounter := 1 // distance between previous dest ID to next dest ID
 			// get next srcId from srcId list
 			srcId, srcOk := ss.NextId()
-			if !srcOk || srcId > maxSrcId {
+			if !srcOk {
 				break
 			}
+			// a listed ID without an entry leaves its destination ID unused
+			unused := !keepGap && ss.isListed(srcId)
+			if srcId > maxSrcId {
+				if srcId >= ss.OpenStart {
+					// the end of the open-ended range
+					break
+				}
+				if unused {
+					dest.NextId()
+				}
+				continue
+			}
 			if prevId != -1 {
-				if cfg.keepGap {
+				if keepGap {
 					stepCounter = srcId - prevId
 				}
 			}
 			prevId = srcId
 
 			// get save entry of the id
-			se, ok := srcM[srcId]
+			se, ok := srcSnapshot[srcId]
+			if ok && moved[srcId] {
+				ok = false
+			}
 			if !ok { // no entry found at the id
 				prevId -= stepCounter // rewind the distance
+				if unused {
+					dest.NextId()
+				}
 				continue
 			}
+			err = ss.checkProtected(se, "move")
+			if err != nil {
+				return
+			}
 
 			var destId int
 			var destOk bool
-			if cfg.keepGap {
+			if keepGap {
 				for stepCounter > 0 {
 					destId, destOk = dest.NextId()
 					stepCounter--
@@ -365,47 +502,68 @@ func cmdMv(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 				err = fmt.Errorf("too many source savefiles")
 				return
 			}
-
 			overwrite := true
-			if _, ok := destM[destId]; ok {
+			conflictId := destId
+			if existing, ok := destM[destId]; ok {
 				// destination file has an entry with the same ID
-				if cfg.force {
-					overwrite = true
-				} else {
-					// show an overwrite prompt
-					overwrite = promptYN(fmt.Sprintf("Overwrite %s with %s? (y/N) ", dest.displayPath(destId), ss.displayPath(srcId)), false)
+				destId, overwrite, err = resolveConflict(dest, destId, existing, se, ss.displayPath(srcId))
+				if err != nil {
+					return
 				}
 			}
 
 			if overwrite {
-				if cfg.verbose {
-					fmt.Printf("moving %s to %s\n", ss.displayPath(srcId), dest.displayPath(destId))
-				}
-				se.Id = destId
-				newSave = append(newSave, se)
+				srcPath := ss.displayPath(srcId)
 				delete(srcM, srcId)
+				moved[srcId] = true
 				if sameFile { // the src and dest is same file
 					delete(destM, srcId)
 				}
-				moveCount++
+				if destId == idFreeSlot {
+					renames = append(renames, renamed{se, conflictId, srcPath})
+					continue
+				}
+				err = moveEntry(se, destId, srcPath)
+				if err != nil {
+					return
+				}
 			}
 		}
 		// save savedata of a source file
 		saveFiles[ss.NormalizedPath] = srcM
 	}
+	for _, r := range renames {
+		id := nextFreeId(r.id, func(id int) bool {
+			if _, used := destM[id]; used {
+				return true
+			}
+			for _, e := range newSave {
+				if e.Id == id {
+					return true
+				}
+			}
+			return false
+		})
+		err = moveEntry(r.se, id, r.srcPath)
+		if err != nil {
+			return
+		}
+	}
 
-	// write move destination file
+	// write move destination file; the destination and all source files are written in one transaction
+	t := newFileTransaction()
+	defer t.discard()
 	for _, e := range destM {
 		newSave = append(newSave, e)
 	}
 	sort.Slice(newSave, func(i, j int) bool { return newSave[i].Id < newSave[j].Id })
-	err = dest.writeSaveToPath(newSave, cfg.rawJson, cfg.prettyJson)
+	err = dest.stageSaveToPath(t, newSave, cfg.rawJson, cfg.prettyJson)
 	if err != nil {
 		return
 	}
 	if dest.IsRpgMvSave {
 		// delete move source files
-		err = removeUnusedRpgMvSave(dest.NormalizedPath, newSave)
+		err = removeUnusedRpgMvSave(t, dest.NormalizedPath, newSave)
 		if err != nil {
 			return
 		}
@@ -422,18 +580,22 @@ func cmdMv(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 			save = append(save, e)
 		}
 		sort.Slice(save, func(i, j int) bool { return save[i].Id < save[j].Id })
-		err = ss.writeSaveToPath(save, cfg.rawJson, cfg.prettyJson)
+		err = ss.stageSaveToPath(t, save, cfg.rawJson, cfg.prettyJson)
 		if err != nil {
 			return
 		}
 		if ss.IsRpgMvSave {
 			// delete move source files
-			err = removeUnusedRpgMvSave(ss.NormalizedPath, save)
+			err = removeUnusedRpgMvSave(t, ss.NormalizedPath, save)
 			if err != nil {
 				return
 			}
 		}
 	}
+	err = t.commit()
+	if err != nil {
+		return
+	}
 	if cfg.verbose {
 		fmt.Printf("%d saves moved\n", moveCount)
 	}
@@ -443,15 +605,7 @@ func cmdMv(src []*saveFileSelector, dest *saveFileSelector) (err error) {
 
 // show Yes/No prompt
 func promptYN(msg string, defaultYes bool) bool {
-	tt, err := tty.Open()
-	if err != nil {
-		return defaultYes
-	}
-	defer tt.Close()
-
-	fmt.Print(msg)
-	r, err := tt.ReadRune()
-	fmt.Print("\n")
+	r, err := promptKey(msg)
 	if err == nil {
 		s := strings.ToLower(string(r))
 		if s == "y" {
@@ -462,3 +616,27 @@ func promptYN(msg string, defaultYes bool) bool {
 	}
 	return defaultYes
 }
+
+// check whether the prompt can be shown
+func hasTerminal() bool {
+	tt, err := tty.Open()
+	if err != nil {
+		return false
+	}
+	tt.Close()
+	return true
+}
+
+// show a prompt and read a key from the terminal
+func promptKey(msg string) (r rune, err error) {
+	tt, err := tty.Open()
+	if err != nil {
+		return
+	}
+	defer tt.Close()
+
+	fmt.Print(msg)
+	r, err = tt.ReadRune()
+	fmt.Print("\n")
+	return
+}
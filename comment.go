@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNoComment = errors.New("comments can be stored only in archive files")
+)
+
+// expand placeholders in a comment template with the values of the index entry.
+// {map}, {date} and {playtime} are replaced with the map name, the save time and the play time.
+func expandComment(tmpl string, se *saveEntry) string {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl
+	}
+	mapName, date, playtime := "", "", ""
+	if ie, err := se.indexEntry(); err == nil {
+		mapName, playtime = ie.MapName, ie.Playtime
+		if ie.Timestamp != 0 {
+			date = ie.timestamp().Format("2006-01-02 15:04")
+		}
+	}
+	r := strings.NewReplacer(
+		"{map}", mapName,
+		"{date}", date,
+		"{playtime}", playtime,
+	)
+	return r.Replace(tmpl)
+}
+
+// stamp the comment given with -c flag to an entry
+func stampComment(se *saveEntry) {
+	if cfg.setComment {
+		se.Comment = expandComment(cfg.comment, se)
+	}
+}
+
+// set, append or clear comments of archive entries
+func cmdComment(ss *saveFileSelector, op string, text string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	if ss.IsRpgMvSave {
+		return ErrNoComment
+	}
+
+	switch op {
+	case "set", "append":
+		if text == "" {
+			return fmt.Errorf("please provide a comment")
+		}
+	case "clear":
+	default:
+		return fmt.Errorf("unknown comment operation: %s", op)
+	}
+
+	count, err := editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+		c := se.Comment
+		switch op {
+		case "set":
+			c = expandComment(text, se)
+		case "append":
+			if c != "" {
+				c += " "
+			}
+			c += expandComment(text, se)
+		case "clear":
+			c = ""
+		}
+		if c == se.Comment {
+			return false, nil
+		}
+		if cfg.verbose {
+			fmt.Printf("%s: %q\n", ss.displayPath(se.Id), c)
+		}
+		se.Comment = c
+		return true, nil
+	})
+	if err != nil {
+		return
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d comments modified\n", count)
+	}
+	return
+}
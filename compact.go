@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// renumber entries of a save to the new IDs, newIds[i] for entries[i], and write all entries of the save.
+// a protected entry is not renumbered unless --unprotect is given.
+// returns the number of renumbered entries.
+func renumberEntries(ss *saveFileSelector, all []*saveEntry, entries []*saveEntry, newIds []int) (count int, err error) {
+	for i, se := range entries {
+		if se.Id != newIds[i] {
+			err = ss.checkProtected(se, "renumber")
+			if err != nil {
+				return
+			}
+		}
+	}
+	for i, se := range entries {
+		newId := newIds[i]
+		if se.Id == newId {
+			continue
+		}
+		if cfg.verbose {
+			fmt.Printf("renumbering %s to %s\n", ss.displayPath(se.Id), ss.displayPath(newId))
+		}
+		se.Id = newId
+		count++
+	}
+	if count == 0 {
+		return
+	}
+
+	// all save bodies are in memory; write them at the new IDs, then remove the files left at old IDs
+	save := make([]*saveEntry, len(all))
+	copy(save, all)
+	sort.Slice(save, func(i, j int) bool { return save[i].Id < save[j].Id })
+	t := newFileTransaction()
+	defer t.discard()
+	err = ss.stageSaveToPath(t, save, cfg.rawJson, cfg.prettyJson)
+	if err != nil {
+		return
+	}
+	if ss.IsRpgMvSave {
+		err = removeUnusedRpgMvSave(t, ss.NormalizedPath, save)
+		if err != nil {
+			return
+		}
+	}
+	err = t.commit()
+	return
+}
+
+// print the result of renumbering
+func printRenumberCount(count int) {
+	switch {
+	case cfg.dryRun:
+		fmt.Printf("%d saves would be renumbered (dry run)\n", count)
+	case !cfg.verbose:
+	case count == 0:
+		fmt.Printf("no saves renumbered\n")
+	default:
+		fmt.Printf("%d saves renumbered\n", count)
+	}
+}
+
+// renumber all entries of a save to start, start+1, ... without gaps
+func cmdCompact(ss *saveFileSelector, startId string) (err error) {
+	start := 1
+	if startId != "" {
+		start, err = strconv.Atoi(startId)
+		if err != nil || start <= 0 {
+			return fmt.Errorf("invalid start id: %s", startId)
+		}
+	}
+	if len(ss.IdList) > 0 || ss.OpenStart > 1 || ss.Query != nil {
+		return fmt.Errorf("compact renumbers all entries; please provide a filename without %cid", idSeparator)
+	}
+
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	by := cfg.orderBy
+	if by == "" {
+		by = "id"
+	}
+	err = sortEntriesBy(entries, by)
+	if err != nil {
+		return
+	}
+
+	newIds := make([]int, len(entries))
+	for i := range entries {
+		newIds[i] = start + i
+	}
+	if len(entries) > 0 {
+		limit, source := ss.maxSavefiles()
+		err = ss.checkSlotLimit(newIds[len(newIds)-1], limit, source)
+		if err != nil {
+			return
+		}
+	}
+	count, err := renumberEntries(ss, entries, entries, newIds)
+	if err != nil {
+		return
+	}
+	printRenumberCount(count)
+	return
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// policies to resolve a conflict, when the destination already has an entry at the ID
+const (
+	conflictAsk       = "ask"       // ask with a prompt
+	conflictSkip      = "skip"      // keep the existing entry
+	conflictOverwrite = "overwrite" // overwrite the existing entry
+	conflictRename    = "rename"    // place the entry in the next free slot
+	conflictNewer     = "newer"     // overwrite if the entry is saved later than the existing one
+	conflictFail      = "fail"      // stop the command
+)
+
+var conflictPolicies = []string{conflictAsk, conflictSkip, conflictOverwrite, conflictRename, conflictNewer, conflictFail}
+
+// the policy chosen with "all" or "none" answers to the prompt, used for the rest of the conflicts
+var conflictAnswer string
+
+// max number of lines of differences shown in the prompt
+const maxDiffLines = 40
+
+var (
+	ErrConflict = errors.New("the destination already has an entry")
+)
+
+// check the name of a conflict policy
+func parseConflictPolicy(s string) (policy string, err error) {
+	for _, p := range conflictPolicies {
+		if s == p {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown conflict policy: %s. valid policies are %s", s, strings.Join(conflictPolicies, ", "))
+}
+
+// the conflict policy set with --on-conflict, or -f flag
+func conflictPolicy() string {
+	if conflictAnswer != "" {
+		return conflictAnswer
+	}
+	if cfg.onConflict != "" {
+		return cfg.onConflict
+	}
+	if cfg.force {
+		return conflictOverwrite
+	}
+	return conflictAsk
+}
+
+// the ID returned by resolveConflict to place the entry in a free slot.
+// the slot is chosen with nextFreeId after all other entries of the command are placed, so it is not taken by them
+const idFreeSlot = 0
+
+// resolve a conflict of writing src to the destination ID which already has an entry.
+// returns the ID to write the entry, idFreeSlot to place it in a free slot, or ok=false to skip the entry.
+// a protected entry is not overwritten unless --unprotect is given.
+func resolveConflict(dest *saveFileSelector, id int, existing, src *saveEntry, srcPath string) (newId int, ok bool, err error) {
+	destPath := dest.displayPath(id)
+	report := func(msg string) {
+		if cfg.verbose {
+			fmt.Printf("%s exists; %s\n", destPath, msg)
+		}
+	}
+
+	switch conflictPolicy() {
+	case conflictOverwrite:
+		err = dest.checkProtected(existing, "overwrite")
+		if err != nil {
+			return
+		}
+		if cfg.dryRun {
+			report("overwriting with " + srcPath)
+		}
+		return id, true, nil
+
+	case conflictSkip:
+		report("skipping " + srcPath)
+		return id, false, nil
+
+	case conflictRename:
+		report(fmt.Sprintf("placing %s to a free slot", srcPath))
+		return idFreeSlot, true, nil
+
+	case conflictNewer:
+		if isNewer(src, existing) {
+			err = dest.checkProtected(existing, "overwrite")
+			if err != nil {
+				return
+			}
+			report(fmt.Sprintf("overwriting with newer %s", srcPath))
+			return id, true, nil
+		}
+		report(fmt.Sprintf("keeping it; %s is not newer", srcPath))
+		return id, false, nil
+
+	case conflictFail:
+		return id, false, fmt.Errorf("%w: %s", ErrConflict, destPath)
+	}
+
+	// ask
+	err = dest.checkProtected(existing, "overwrite")
+	if err != nil {
+		return
+	}
+	if cfg.dryRun {
+		report(fmt.Sprintf("overwriting with %s (asked without -f; assumed yes in dry run)", srcPath))
+		return id, true, nil
+	}
+	noPrompt := func() (int, bool, error) {
+		// keep the entry, as without the policies
+		fmt.Fprintf(os.Stderr, "warning: cannot ask to overwrite %s without a terminal; keeping it. use --on-conflict to set how to resolve conflicts\n", destPath)
+		return id, false, nil
+	}
+	if !hasTerminal() {
+		return noPrompt()
+	}
+	fmt.Printf("%s already exists.\n", destPath)
+	printEntryComparison(existing, src, srcPath)
+	for {
+		r, e := promptKey(fmt.Sprintf("Overwrite %s with %s? [y]es, [n]o, [a]ll, n[o]ne, [r]ename, [d]iff (default: no) ", destPath, srcPath))
+		if e != nil {
+			return noPrompt()
+		}
+		switch r {
+		case 'y', 'Y':
+			return id, true, nil
+		case 'a', 'A':
+			conflictAnswer = conflictOverwrite
+			return id, true, nil
+		case 'o', 'O':
+			conflictAnswer = conflictSkip
+			return id, false, nil
+		case 'r', 'R':
+			return idFreeSlot, true, nil
+		case 'd', 'D':
+			printEntryDiff(existing, src)
+			continue
+		}
+		return id, false, nil
+	}
+}
+
+// find the first ID after the id which is not used
+func nextFreeId(id int, used func(id int) bool) int {
+	id++
+	for used(id) {
+		id++
+	}
+	return id
+}
+
+// summary of an entry shown in the overwrite prompt: savetime, playtime, map, gold, party and comment
+func entrySummary(se *saveEntry) []string {
+	savetime, playtime, mapName, gold, party := "", "", "", "", ""
+	if ie, e := se.indexEntry(); e == nil {
+		savetime = ie.timestamp().Format("2006-01-02 15:04:05")
+		playtime, mapName, gold = ie.Playtime, ie.MapName, fmt.Sprint(ie.Gold)
+	}
+	if b, e := se.body(); e == nil {
+		members, _ := b.partyMembers()
+		names := make([]string, 0, len(members))
+		for _, id := range members {
+			actor, _ := b.actor(id)
+			if actor == nil {
+				names = append(names, fmt.Sprintf("#%d", id))
+				continue
+			}
+			name, _ := actor["_name"].(string)
+			if level, ok := jsonInt(actor["_level"]); ok {
+				name += fmt.Sprintf(" Lv%d", level)
+			}
+			names = append(names, name)
+		}
+		party = strings.Join(names, ", ")
+	}
+	return []string{savetime, playtime, mapName, gold, party, se.Comment}
+}
+
+// print the existing and the incoming entries side by side
+func printEntryComparison(existing, src *saveEntry, srcPath string) {
+	labels := []string{"savetime", "playtime", "map", "gold", "party", "comment"}
+	a, b := entrySummary(existing), entrySummary(src)
+	lines := []string{"\000existing\000incoming (" + srcPath + ")"}
+	for i, l := range labels {
+		if a[i] == "" && b[i] == "" {
+			continue
+		}
+		mark := ""
+		if a[i] != b[i] {
+			mark = " *"
+		}
+		lines = append(lines, fmt.Sprintf("  %s%s\000%s\000%s", l, mark, a[i], b[i]))
+	}
+	printAlignedLines(lines, "\000")
+}
+
+// print the differences of the save bodies of two entries
+func printEntryDiff(existing, src *saveEntry) {
+	a, ea := existing.body()
+	b, eb := src.body()
+	if ea != nil || eb != nil {
+		fmt.Printf("cannot compare the saves\n")
+		return
+	}
+	diff := make([]string, 0)
+	jsonDiff(map[string]any(a), map[string]any(b), "", &diff)
+	if len(diff) == 0 {
+		fmt.Printf("the save bodies are the same\n")
+		return
+	}
+	for i, d := range diff {
+		if i >= maxDiffLines {
+			fmt.Printf("... and %d more differences\n", len(diff)-maxDiffLines)
+			break
+		}
+		fmt.Println(d)
+	}
+}
+
+// list differences of two json values as "path: old -> new".
+// JsonEx object IDs ("@c") are ignored, and JsonEx array wrappers are transparent
+func jsonDiff(a, b any, path string, out *[]string) {
+	if jsonEqual(a, b) {
+		return
+	}
+	short := func(v any) string {
+		if v == nil {
+			return "(none)"
+		}
+		data, _ := encodeJsonValue(v)
+		s := string(data)
+		if len([]rune(s)) > 40 {
+			s = string([]rune(s)[:40]) + "..."
+		}
+		return s
+	}
+	am, aIsMap := a.(map[string]any)
+	bm, bIsMap := b.(map[string]any)
+	if aIsMap && bIsMap {
+		if _, ok := am["@a"]; ok {
+			jsonDiff(am["@a"], bm["@a"], path, out)
+			return
+		}
+		keys := make([]string, 0)
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if k == "@c" {
+				continue
+			}
+			jsonDiff(am[k], bm[k], path+"/"+k, out)
+		}
+		return
+	}
+	aa, aIsArray := a.([]any)
+	ba, bIsArray := b.([]any)
+	if aIsArray && bIsArray {
+		n := len(aa)
+		if len(ba) > n {
+			n = len(ba)
+		}
+		for i := 0; i < n; i++ {
+			var x, y any
+			if i < len(aa) {
+				x = aa[i]
+			}
+			if i < len(ba) {
+				y = ba[i]
+			}
+			jsonDiff(x, y, fmt.Sprintf("%s/%d", path, i), out)
+		}
+		return
+	}
+	*out = append(*out, fmt.Sprintf("%s: %s -> %s", path, short(a), short(b)))
+}
+
+// check whether an entry is saved later than another, by the timestamps of the index
+func isNewer(se, than *saveEntry) bool {
+	a, e := se.indexEntry()
+	if e != nil {
+		return false
+	}
+	b, e := than.indexEntry()
+	if e != nil {
+		return true
+	}
+	return a.Timestamp > b.Timestamp
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	assignMatch     = regexp.MustCompile(`^(\w+)\[(.*)\]=(.*)$`)                      // TARGET[KEY]=VALUE
+	selfSwitchMatch = regexp.MustCompile(`^(?:map=)?(\d+),(?:event=)?(\d+),([A-D])$`) // map=MAPID,event=EVENTID,LETTER
+)
+
+// select entries matching the ID list of the selector.
+func (ss *saveFileSelector) selectEntries(entries []*saveEntry) []*saveEntry {
+	sel := make([]*saveEntry, 0)
+	for _, e := range entries {
+		if ss.selects(e.Id) {
+			sel = append(sel, e)
+		}
+	}
+	return sel
+}
+
+// apply fn to the entries selected by ss, then write all entries back if any entry is modified.
+// fn should return true if the entry is modified.
+func editEntries(ss *saveFileSelector, entries []*saveEntry, fn func(se *saveEntry) (modified bool, err error)) (count int, err error) {
+	for _, se := range ss.selectEntries(entries) {
+		modified, e := fn(se)
+		if e != nil {
+			err = fmt.Errorf("%s: %w", ss.displayPath(se.Id), e)
+			return
+		}
+		if modified {
+			count++
+		}
+	}
+	if count == 0 {
+		return
+	}
+	err = ss.writeSaveToPath(entries, cfg.rawJson, cfg.prettyJson)
+	return
+}
+
+// an assignment to a game state value in the save body
+type saveAssignment struct {
+	text string // the assignment string
+
+	target string // "switches", "variables" or "selfSwitches"
+	id     int    // switch or variable ID
+	key    string // self switch key "MAPID,EVENTID,LETTER"
+	value  any    // value to be set
+}
+
+// parse an assignment string such as `switch[12]=on`, `variable["Chapter"]=3`, `selfswitch[map=3,event=7,A]=off`.
+// switch and variable names are resolved with the game data.
+func parseAssignment(s string, gd *gameData) (a *saveAssignment, err error) {
+	m := assignMatch.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid assignment: %s", s)
+	}
+	name, key, value := strings.ToLower(m[1]), m[2], strings.TrimSpace(m[3])
+	a = &saveAssignment{text: s}
+
+	switch name {
+	case "switch", "switches", "sw":
+		a.target = "switches"
+		a.id, err = resolveId(key, func() ([]string, error) {
+			sys, e := gd.system()
+			if e != nil {
+				return nil, e
+			}
+			return sys.Switches, nil
+		})
+		if err != nil {
+			return
+		}
+		a.value, err = parseOnOff(value)
+
+	case "variable", "variables", "var":
+		a.target = "variables"
+		a.id, err = resolveId(key, func() ([]string, error) {
+			sys, e := gd.system()
+			if e != nil {
+				return nil, e
+			}
+			return sys.Variables, nil
+		})
+		if err != nil {
+			return
+		}
+		if n, e := strconv.Atoi(value); e == nil {
+			a.value = jsonNumber(n)
+		} else if str, e := strconv.Unquote(value); e == nil {
+			a.value = str
+		} else {
+			err = fmt.Errorf("invalid variable value: %s", value)
+		}
+
+	case "selfswitch", "selfswitches", "ss":
+		a.target = "selfSwitches"
+		k := selfSwitchMatch.FindStringSubmatch(strings.ReplaceAll(key, " ", ""))
+		if k == nil {
+			return nil, fmt.Errorf("invalid self switch: %s", key)
+		}
+		a.key = k[1] + "," + k[2] + "," + k[3]
+		a.value, err = parseOnOff(value)
+
+	default:
+		return nil, fmt.Errorf("unknown assignment target: %s", m[1])
+	}
+	if err != nil {
+		return
+	}
+	if a.target != "selfSwitches" && a.id <= 0 {
+		return nil, fmt.Errorf("invalid id: %s", s)
+	}
+	return
+}
+
+// parse a switch value
+func parseOnOff(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid switch value: %s", s)
+}
+
+// apply the assignment to a save body. returns the previous value.
+func (a *saveAssignment) apply(b saveBody) (old any, err error) {
+	obj, err := b.object(a.target)
+	if err != nil {
+		return
+	}
+
+	if a.target == "selfSwitches" {
+		// self switches are stored as an object of "MAPID,EVENTID,LETTER": true
+		data := jsonExObject(obj["_data"])
+		if data == nil {
+			return nil, fmt.Errorf("%w: %s._data", ErrNoSaveObject, a.target)
+		}
+		old = data[a.key] == true
+		if a.value == true {
+			data[a.key] = true
+		} else {
+			delete(data, a.key) // Game_SelfSwitches removes the key when turned off
+		}
+		return
+	}
+
+	// switches and variables are stored as an array
+	data := jsonExArray(obj["_data"])
+	if data == nil {
+		if _, ok := obj["_data"]; !ok {
+			return nil, fmt.Errorf("%w: %s._data", ErrNoSaveObject, a.target)
+		}
+	}
+	if a.id < len(data) {
+		old = data[a.id]
+	}
+	data, err = growArray(data, a.id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a.target, err)
+	}
+	data[a.id] = a.value
+	jsonExSetArray(obj, "_data", data)
+	return
+}
+
+// set game state values in savefiles
+func cmdSet(ss *saveFileSelector, assign []string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+
+	gd := openGameData(ss)
+	al := make([]*saveAssignment, len(assign))
+	for i, s := range assign {
+		al[i], err = parseAssignment(s, gd)
+		if err != nil {
+			return
+		}
+	}
+
+	count, err := editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+		body, err := se.body()
+		if err != nil {
+			return
+		}
+		if cfg.verbose {
+			fmt.Printf("modifying %s\n", ss.displayPath(se.Id))
+		}
+		for _, a := range al {
+			var old any
+			old, err = a.apply(body)
+			if err != nil {
+				return
+			}
+			if cfg.verbose {
+				fmt.Printf("  %s (was %s)\n", a.text, jsonString(old))
+			}
+		}
+		return true, se.setBody(body)
+	})
+	if err != nil {
+		return
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves modified\n", count)
+	}
+	return
+}
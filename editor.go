@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var (
+	ErrEditAborted = errors.New("edit aborted")
+)
+
+// get the editor command line from $VISUAL or $EDITOR
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if f := strings.Fields(os.Getenv(env)); len(f) > 0 {
+			return f
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// open a file with the editor and wait until the editor exits
+func runEditor(filename string) error {
+	c := editorCommand()
+	cmd := exec.Command(c[0], append(c[1:], filename)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// a document to be edited: the index entry and the save body
+type editDocument struct {
+	Index json.RawMessage `json:"index"`
+	Body  saveBody        `json:"body"`
+}
+
+// make a pretty-printed json of the entry to be edited
+func makeEditDocument(se *saveEntry) (data []byte, err error) {
+	body, err := se.body()
+	if err != nil {
+		return
+	}
+	doc := editDocument{Index: se.IndexJson, Body: body}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(doc)
+	return buf.Bytes(), err
+}
+
+// validate an edited document. if needIndex is true, the document must have an index entry.
+func parseEditDocument(data []byte, needIndex bool) (doc *editDocument, err error) {
+	err = decodeJsonValue(data, &doc)
+	if err != nil {
+		return
+	}
+	if doc == nil || doc.Body == nil {
+		return nil, fmt.Errorf("the document must have a \"body\" object")
+	}
+	if len(doc.Index) > 0 && !bytes.Equal(doc.Index, []byte("null")) {
+		var ie map[string]any
+		err = decodeJsonValue(doc.Index, &ie)
+		if err != nil || ie == nil {
+			return nil, fmt.Errorf("\"index\" must be an object")
+		}
+	} else if needIndex {
+		return nil, fmt.Errorf("the document must have an \"index\" object")
+	} else {
+		doc.Index = nil
+	}
+	return
+}
+
+// synchronize the index entry with the save body; party characters and the amount of gold
+func syncIndexWithBody(se *saveEntry, b saveBody, gd *gameData) (err error) {
+	if se.IndexJson == nil {
+		return
+	}
+	if e := updatePartyIndex(se, b, gd); e != nil && cfg.verbose {
+		// the characters could not be determined without the game data; keep the old ones
+		fmt.Fprintf(os.Stderr, "party characters in the index are not updated: %v\n", e)
+	}
+	party, err := b.object("party")
+	if err != nil {
+		return
+	}
+	return se.updateIndex(func(ie map[string]any) error {
+		if _, ok := ie["gold"]; ok {
+			ie["gold"] = party["_gold"]
+		}
+		return nil
+	})
+}
+
+// edit an entry with the editor. returns false if the entry is not modified.
+func editEntryWithEditor(se *saveEntry, name string, gd *gameData) (modified bool, err error) {
+	data, err := makeEditDocument(se)
+	if err != nil {
+		return
+	}
+	f, err := os.CreateTemp("", fmt.Sprintf("rpgsave-%d-*.json", se.Id))
+	if err != nil {
+		return
+	}
+	tmpName := f.Name()
+	defer os.Remove(tmpName)
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+
+	var doc *editDocument
+	for {
+		err = runEditor(tmpName)
+		if err != nil {
+			return
+		}
+		var edited []byte
+		edited, err = os.ReadFile(tmpName)
+		if err != nil {
+			return
+		}
+		if bytes.Equal(edited, data) {
+			return false, nil
+		}
+		doc, err = parseEditDocument(edited, se.IndexJson != nil)
+		if err == nil {
+			break
+		}
+		// refuse to save invalid edits
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		if !promptYN("Reopen the editor? (y/N) ", false) {
+			return false, ErrEditAborted
+		}
+	}
+
+	// the index is synchronized with the body, unless the user has edited the index
+	indexEdited := doc.Index != nil && se.IndexJson != nil && !jsonTextEqual(doc.Index, se.IndexJson)
+	orig := *se
+	se.IndexJson = []byte(doc.Index)
+	err = se.setBody(doc.Body)
+	if err == nil && !indexEdited {
+		err = syncIndexWithBody(se, doc.Body, gd)
+	}
+	if err != nil {
+		*se = orig
+		return
+	}
+	return true, nil
+}
+
+// edit savefiles with the editor
+func cmdEdit(ss *saveFileSelector) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	gd := openGameData(ss)
+
+	count, name := 0, ""
+	for _, se := range ss.selectEntries(entries) {
+		name = ss.displayPath(se.Id)
+		if cfg.verbose {
+			fmt.Printf("editing %s\n", name)
+		}
+		modified, e := editEntryWithEditor(se, name, gd)
+		if e != nil {
+			err = fmt.Errorf("%s: %w", name, e)
+			break
+		}
+		if modified {
+			count++
+		} else if cfg.verbose {
+			fmt.Printf("%s not modified\n", name)
+		}
+	}
+	if err != nil {
+		// keep the saves edited before the error, unless the user discards them
+		if count == 0 || !promptYN(fmt.Sprintf("Editing %s failed. Save the %d saves edited so far? (Y/n) ", name, count), true) {
+			return
+		}
+		if e := ss.writeSaveToPath(entries, cfg.rawJson, cfg.prettyJson); e != nil {
+			return e
+		}
+		if cfg.verbose {
+			fmt.Printf("%d saves modified\n", count)
+		}
+		return
+	}
+	if count > 0 {
+		err = ss.writeSaveToPath(entries, cfg.rawJson, cfg.prettyJson)
+		if err != nil {
+			return
+		}
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves modified\n", count)
+	}
+	return
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	gameDataSystem  = "System.json"  // system data file in the game data directory
+	gameDataActors  = "Actors.json"  // actor database
+	gameDataClasses = "Classes.json" // class database
+	gameDataSkills  = "Skills.json"  // skill database
+	gameDataItems   = "Items.json"   // item database
+	gameDataWeapons = "Weapons.json" // weapon database
+	gameDataArmors  = "Armors.json"  // armor database
+
+	gameDataMapInfos = "MapInfos.json" // map list
+	gameDataMapFmt   = "Map%03d.json"  // individual map data
+)
+
+var (
+	ErrNoGameData    = errors.New("game data directory not found. use -d to set the directory")
+	ErrNameNotFound  = errors.New("name not found")
+	ErrNameAmbiguous = errors.New("ambiguous name")
+)
+
+// candidate game data directories, relative to a rpg maker mv save directory
+var gameDataDirCandidates = []string{
+	filepath.Join("..", "data"),        // www/save -> www/data
+	filepath.Join("..", "www", "data"), // save -> www/data
+}
+
+// game data files in the data directory of the game, i.e. "www/data/System.json"
+type gameData struct {
+	Dir string // the data directory
+
+	cache map[string][]byte // raw contents of the data files already read
+}
+
+// part of System.json
+type rpgSystemData struct {
+	GameTitle string   `json:"gameTitle"`
+	Switches  []string `json:"switches"`  // switch names. the first entry is always empty
+	Variables []string `json:"variables"` // variable names. the first entry is always empty
+}
+
+// a generic entry of database files, i.e. Items.json, Actors.json
+type rpgDataEntry struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// part of an entry of Actors.json
+type rpgActorData struct {
+	Id             int    `json:"id"`
+	Name           string `json:"name"`
+	ClassId        int    `json:"classId"`
+	MaxLevel       int    `json:"maxLevel"`
+	CharacterName  string `json:"characterName"`
+	CharacterIndex int    `json:"characterIndex"`
+	FaceName       string `json:"faceName"`
+	FaceIndex      int    `json:"faceIndex"`
+}
+
+// part of an entry of Classes.json
+type rpgClassData struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	ExpParams []float64 `json:"expParams"` // basis, extra, acceleration A, acceleration B
+}
+
+// part of a map data file, i.e. Map001.json
+type rpgMapData struct {
+	DisplayName string `json:"displayName"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// find the game data directory for a save.
+// cfg.dataDir is used if set; otherwise the directory is searched around the rpg maker mv save directory.
+func findGameDataDir(ss *saveFileSelector) string {
+	isDataDir := func(dir string) bool {
+		st, err := os.Stat(filepath.Join(dir, gameDataSystem))
+		return err == nil && !st.IsDir()
+	}
+	if cfg.dataDir != "" {
+		return cfg.dataDir
+	}
+	if !ss.IsRpgMvSave {
+		return ""
+	}
+	for _, c := range gameDataDirCandidates {
+		dir := filepath.Join(ss.NormalizedPath, c)
+		if isDataDir(dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// open the game data directory for a save. returns nil if the directory is not found.
+func openGameData(ss *saveFileSelector) *gameData {
+	dir := findGameDataDir(ss)
+	if dir == "" {
+		return nil
+	}
+	return &gameData{Dir: dir, cache: make(map[string][]byte)}
+}
+
+// read a json file in the data directory
+func (gd *gameData) readJson(filename string, v any) (err error) {
+	if gd == nil {
+		return ErrNoGameData
+	}
+	data, ok := gd.cache[filename]
+	if !ok {
+		data, err = os.ReadFile(filepath.Join(gd.Dir, filename))
+		if err != nil {
+			return
+		}
+		gd.cache[filename] = data
+	}
+	return json.Unmarshal(data, v)
+}
+
+// read System.json
+func (gd *gameData) system() (sys *rpgSystemData, err error) {
+	err = gd.readJson(gameDataSystem, &sys)
+	if err == nil && sys == nil {
+		err = fmt.Errorf("%s: %w", gameDataSystem, ErrNoData)
+	}
+	return
+}
+
+// get an actor of Actors.json
+func (gd *gameData) actor(id int) (actor *rpgActorData, err error) {
+	var list []*rpgActorData
+	err = gd.readJson(gameDataActors, &list)
+	if err != nil {
+		return
+	}
+	if id <= 0 || id >= len(list) || list[id] == nil {
+		return nil, fmt.Errorf("%s: %w: %d", gameDataActors, ErrInvalidId, id)
+	}
+	return list[id], nil
+}
+
+// get a class of Classes.json
+func (gd *gameData) class(id int) (class *rpgClassData, err error) {
+	var list []*rpgClassData
+	err = gd.readJson(gameDataClasses, &list)
+	if err != nil {
+		return
+	}
+	if id <= 0 || id >= len(list) || list[id] == nil {
+		return nil, fmt.Errorf("%s: %w: %d", gameDataClasses, ErrInvalidId, id)
+	}
+	return list[id], nil
+}
+
+// get a map data file
+func (gd *gameData) mapData(id int) (m *rpgMapData, err error) {
+	err = gd.hasData(gameDataMapInfos, id)
+	if err != nil {
+		return
+	}
+	filename := fmt.Sprintf(gameDataMapFmt, id)
+	err = gd.readJson(filename, &m)
+	if err == nil && m == nil {
+		err = fmt.Errorf("%s: %w", filename, ErrNoData)
+	}
+	return
+}
+
+// get the name of a map to be displayed; the display name if set, otherwise the name in MapInfos.json
+func (gd *gameData) mapName(id int) (name string, err error) {
+	m, err := gd.mapData(id)
+	if err != nil {
+		return
+	}
+	if m.DisplayName != "" {
+		return m.DisplayName, nil
+	}
+	list, err := gd.dataList(gameDataMapInfos)
+	if err != nil {
+		return
+	}
+	return list[id].Name, nil
+}
+
+// check whether an id exists in a database file
+func (gd *gameData) hasData(filename string, id int) (err error) {
+	list, err := gd.dataList(filename)
+	if err != nil {
+		return
+	}
+	if id <= 0 || id >= len(list) || list[id] == nil {
+		return fmt.Errorf("%s: %w: %d", filename, ErrInvalidId, id)
+	}
+	return nil
+}
+
+// find the index of a name in a name list
+func findName(names []string, name string) (id int, err error) {
+	id = -1
+	for i, n := range names {
+		if n == "" || n != name {
+			continue
+		}
+		if id != -1 {
+			return -1, fmt.Errorf("%w: %q", ErrNameAmbiguous, name)
+		}
+		id = i
+	}
+	if id == -1 {
+		return -1, fmt.Errorf("%w: %q", ErrNameNotFound, name)
+	}
+	return
+}
+
+// resolve a numeric id or a quoted name to an id, using a name list.
+// the name list is acquired by calling names() only if the key is a quoted name.
+func resolveId(key string, names func() ([]string, error)) (id int, err error) {
+	key = strings.TrimSpace(key)
+	if n, e := strconv.Atoi(key); e == nil {
+		return n, nil
+	}
+	name, err := strconv.Unquote(key)
+	if err != nil {
+		return -1, fmt.Errorf("invalid id or name: %s", key)
+	}
+	list, err := names()
+	if err != nil {
+		return
+	}
+	return findName(list, name)
+}
+
+// read a database file that is a list of entries, i.e. Items.json
+func (gd *gameData) dataList(filename string) (list []*rpgDataEntry, err error) {
+	err = gd.readJson(filename, &list)
+	return
+}
+
+// get names of a database entry list, indexed by id
+func dataNames(list []*rpgDataEntry) []string {
+	names := make([]string, len(list))
+	for _, e := range list {
+		if e != nil && e.Id >= 0 && e.Id < len(names) {
+			names[e.Id] = e.Name
+		}
+	}
+	return names
+}
+
+// a name list getter of a database file, to be used with resolveId()
+func (gd *gameData) dataNameList(filename string) func() ([]string, error) {
+	return func() ([]string, error) {
+		list, err := gd.dataList(filename)
+		if err != nil {
+			return nil, err
+		}
+		return dataNames(list), nil
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxItemCount = 99 // Game_Party.maxItems()
+)
+
+var (
+	itemSpecMatch = regexp.MustCompile(`^(?:(item|weapon|armor):)?(.+?)(?:x(\d+))?(?:=(\d+))?$`) // KIND:ID, KIND:IDxCOUNT, KIND:ID=COUNT
+)
+
+// item kinds and their containers in Game_Party and database files
+var itemKinds = []struct {
+	kind      string
+	container string
+	filename  string
+}{
+	{"item", "_items", gameDataItems},
+	{"weapon", "_weapons", gameDataWeapons},
+	{"armor", "_armors", gameDataArmors},
+}
+
+// an inventory operation
+type itemOp struct {
+	text string // the operation string
+
+	kind      string // "item", "weapon" or "armor"
+	container string // "_items", "_weapons" or "_armors"
+	id        int    // item ID
+	count     int    // number of items to add, remove or set. -1 to remove all
+}
+
+// parse an item spec such as `12x5`, `weapon:4`, `armor:7=1`, `item:"Potion"x3`.
+// op is "add", "remove" or "set".
+func parseItemOp(op, s string, gd *gameData) (it *itemOp, err error) {
+	m := itemSpecMatch.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid item: %s", s)
+	}
+	it = &itemOp{text: s, kind: m[1]}
+	if it.kind == "" {
+		it.kind = "item"
+	}
+	filename := ""
+	for _, k := range itemKinds {
+		if k.kind == it.kind {
+			it.container, filename = k.container, k.filename
+		}
+	}
+
+	it.id, err = resolveId(m[2], gd.dataNameList(filename))
+	if err != nil {
+		return
+	}
+	if it.id <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidId, s)
+	}
+	if gd != nil {
+		err = gd.hasData(filename, it.id)
+		if err != nil {
+			return
+		}
+	}
+
+	switch op {
+	case "add":
+		if m[4] != "" {
+			return nil, fmt.Errorf("invalid item: %s", s)
+		}
+		it.count = 1
+		if m[3] != "" {
+			it.count, _ = strconv.Atoi(m[3])
+		}
+	case "remove", "rm":
+		if m[4] != "" {
+			return nil, fmt.Errorf("invalid item: %s", s)
+		}
+		it.count = -1
+		if m[3] != "" {
+			it.count, _ = strconv.Atoi(m[3])
+		}
+	case "set":
+		if m[3] != "" || m[4] == "" {
+			return nil, fmt.Errorf("please set the number of items as KIND:ID=COUNT: %s", s)
+		}
+		it.count, _ = strconv.Atoi(m[4])
+	default:
+		return nil, fmt.Errorf("unknown items operation: %s", op)
+	}
+	return
+}
+
+// apply the item operation to the party. returns the previous and the new number of items.
+func (it *itemOp) apply(op string, party map[string]any) (old, n int, err error) {
+	c := jsonExObject(party[it.container])
+	if c == nil {
+		return 0, 0, fmt.Errorf("%w: party.%s", ErrNoSaveObject, it.container)
+	}
+	key := strconv.Itoa(it.id)
+	old, _ = jsonInt(c[key])
+
+	switch op {
+	case "add":
+		n = old + it.count
+	case "remove", "rm":
+		n = old - it.count
+		if it.count < 0 {
+			n = 0
+		}
+	case "set":
+		n = it.count
+	}
+
+	// same as Game_Party.gainItem()
+	if n < 0 {
+		n = 0
+	} else if n > maxItemCount {
+		n = maxItemCount
+	}
+	if n == 0 {
+		delete(c, key)
+	} else {
+		c[key] = jsonNumber(n)
+	}
+	return
+}
+
+// list items of the party
+func listItems(party map[string]any, gd *gameData) {
+	lines := make([]string, 0)
+	for _, k := range itemKinds {
+		c := jsonExObject(party[k.container])
+		ids := make([]int, 0)
+		for key, v := range c {
+			id, e := strconv.Atoi(key)
+			if e != nil {
+				continue // "@c"
+			}
+			if n, ok := jsonInt(v); ok && n > 0 {
+				ids = append(ids, id)
+			}
+		}
+		sort.Ints(ids)
+		var names []string
+		if gd != nil {
+			names, _ = gd.dataNameList(k.filename)()
+		}
+		for _, id := range ids {
+			name := ""
+			if id < len(names) {
+				name = names[id]
+			}
+			n, _ := jsonInt(c[strconv.Itoa(id)])
+			lines = append(lines, fmt.Sprintf("  %s:%d\000%s\000x%d", k.kind, id, name, n))
+		}
+	}
+	printAlignedLines(lines, "\000")
+}
+
+// list or modify the party inventory in savefiles.
+// op is "add", "remove" or "set"; with an empty op, items are listed.
+func cmdItems(ss *saveFileSelector, op string, items []string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	gd := openGameData(ss)
+
+	if op == "" || op == "ls" {
+		// list items
+		for _, se := range ss.selectEntries(entries) {
+			var body saveBody
+			var party map[string]any
+			body, err = se.body()
+			if err == nil {
+				party, err = body.object("party")
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", ss.displayPath(se.Id), err)
+			}
+			gold, _ := jsonInt(party["_gold"])
+			fmt.Printf("#%d gold %d\n", se.Id, gold)
+			listItems(party, gd)
+		}
+		return
+	}
+
+	op = strings.ToLower(op)
+	if len(items) == 0 {
+		return fmt.Errorf("please provide items")
+	}
+	ops := make([]*itemOp, len(items))
+	for i, s := range items {
+		ops[i], err = parseItemOp(op, s, gd)
+		if err != nil {
+			return
+		}
+	}
+
+	count, err := editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+		body, err := se.body()
+		if err != nil {
+			return
+		}
+		party, err := body.object("party")
+		if err != nil {
+			return
+		}
+		if cfg.verbose {
+			fmt.Printf("modifying %s\n", ss.displayPath(se.Id))
+		}
+		for _, it := range ops {
+			var old, n int
+			old, n, err = it.apply(op, party)
+			if err != nil {
+				return
+			}
+			if cfg.verbose {
+				fmt.Printf("  %s:%d x%d -> x%d\n", it.kind, it.id, old, n)
+			}
+		}
+		return true, se.setBody(body)
+	})
+	if err != nil {
+		return
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves modified\n", count)
+	}
+	return
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	journalDirName    = ".rpgmv-savetool"        // hidden directory next to the saves
+	journalSubDir     = "journal"                // journal records in the hidden directory
+	journalManifest   = "journal.json"           // description of a journal record
+	journalFileFmt    = "%d.dat"                 // previous contents of a file in a journal record
+	journalTimeFormat = "20060102-150405.000000" // name of a journal record
+	maxJournalRecords = 50                       // number of records kept in a journal
+)
+
+var (
+	ErrNoJournal      = errors.New("no operations to undo")
+	ErrJournalChanged = errors.New("the file has been changed after the command")
+)
+
+// a journal record: the previous state of the files modified by a command
+type journalRecord struct {
+	Time    time.Time      `json:"time"`
+	Command string         `json:"command"` // the command line
+	Files   []*journalFile `json:"files"`
+	Dirs    []string       `json:"dirs,omitempty"` // the same record in the journals of all directories modified by the command
+
+	dir string // directory of the record
+}
+
+// previous state of a file
+type journalFile struct {
+	Path    string      `json:"path"`    // absolute path of the file
+	Existed bool        `json:"existed"` // false if the file was created by the command
+	Mode    os.FileMode `json:"mode,omitempty"`
+
+	Removed bool   `json:"removed,omitempty"` // the file was removed by the command
+	Hash    string `json:"hash,omitempty"`    // sha256 of the contents written by the command
+}
+
+// get the journal directory for a directory containing saves
+func journalDir(dir string) string {
+	return filepath.Join(dir, journalDirName, journalSubDir)
+}
+
+// get the journal directory of a save
+func (ss *saveFileSelector) journalDir() (dir string, err error) {
+	path, isRpgMvSave, err := detectSaveType(ss.Path)
+	if err != nil {
+		return
+	}
+	if !isRpgMvSave {
+		path = filepath.Dir(path)
+	}
+	return journalDir(path), nil
+}
+
+// get the journal directory for a file; the hidden directory belongs to the directory containing it
+func journalDirOf(filename string) string {
+	dir := filepath.Dir(filename)
+	if filepath.Base(dir) == journalDirName {
+		dir = filepath.Dir(dir)
+	}
+	return journalDir(dir)
+}
+
+// get the hash of file contents
+func contentHash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// record the current state of the files to be modified by a transaction, and returns the directories of the record.
+// the record is stored in the journals of all directories with files modified, so the command can be undone from any of them
+func (t *fileTransaction) recordJournal() (dirs []string, err error) {
+	if len(t.ops) == 0 {
+		return
+	}
+	now := time.Now()
+	rec := &journalRecord{
+		Time:    now,
+		Command: strings.Join(os.Args[1:], " "),
+		Files:   make([]*journalFile, 0, len(t.ops)),
+	}
+	data := make(map[int][]byte) // previous contents of the files
+	seen := make(map[string]bool)
+	for i, op := range t.ops {
+		jf := &journalFile{Removed: op.remove}
+		jf.Path, err = filepath.Abs(op.target)
+		if err != nil {
+			return
+		}
+		if !op.remove {
+			jf.Hash = contentHash(op.data)
+		}
+		st, e := os.Stat(op.target)
+		if e == nil && st.Mode().IsRegular() {
+			data[i], err = os.ReadFile(op.target)
+			if err != nil {
+				return nil, fmt.Errorf("cannot write the journal: %w", err)
+			}
+			jf.Existed, jf.Mode = true, st.Mode().Perm()
+		}
+		rec.Files = append(rec.Files, jf)
+
+		dir := filepath.Join(journalDirOf(jf.Path), now.Format(journalTimeFormat))
+		if !seen[dir] {
+			seen[dir] = true
+			rec.Dirs = append(rec.Dirs, dir)
+		}
+	}
+
+	manifest, err := json.MarshalIndent(rec, "", "\t")
+	if err != nil {
+		return
+	}
+	for _, dir := range rec.Dirs {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			break
+		}
+		dirs = append(dirs, dir)
+		for i, d := range data {
+			err = os.WriteFile(filepath.Join(dir, fmt.Sprintf(journalFileFmt, i)), d, 0644)
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, journalManifest), manifest, 0644)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		removeAll(dirs)
+		return nil, fmt.Errorf("cannot write the journal: %w", err)
+	}
+	for _, dir := range dirs {
+		pruneJournal(filepath.Dir(dir))
+	}
+	return
+}
+
+// remove directories
+func removeAll(dirs []string) {
+	for _, dir := range dirs {
+		os.RemoveAll(dir)
+	}
+}
+
+// remove old records exceeding maxJournalRecords
+func pruneJournal(dir string) {
+	list, err := readJournal(dir)
+	if err != nil {
+		return
+	}
+	for len(list) > maxJournalRecords {
+		os.RemoveAll(list[0].dir)
+		list = list[1:]
+	}
+}
+
+// read all records of a journal, ordered from the oldest
+func readJournal(dir string) (list []*journalRecord, err error) {
+	fl, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	for _, f := range fl {
+		if !f.IsDir() {
+			continue
+		}
+		recDir := filepath.Join(dir, f.Name())
+		data, e := os.ReadFile(filepath.Join(recDir, journalManifest))
+		if e != nil {
+			continue
+		}
+		rec := &journalRecord{}
+		if json.Unmarshal(data, rec) != nil {
+			continue
+		}
+		rec.dir = recDir
+		list = append(list, rec)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].dir < list[j].dir })
+	return
+}
+
+// check a file is in the state written by the command of the record.
+// the state holds the hashes of the files already undone, or an empty hash for a removed file,
+// so the records of a dry run are checked against the files as they would be
+func (jf *journalFile) changed(state map[string]string) bool {
+	hash, ok := state[jf.Path]
+	if !ok {
+		data, err := os.ReadFile(jf.Path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return true
+		default:
+			hash = contentHash(data)
+		}
+	}
+	if jf.Removed {
+		return hash != ""
+	}
+	if jf.Hash == "" {
+		// recorded by an older version
+		return false
+	}
+	return hash != jf.Hash
+}
+
+// restore the files of a record, and update the state with the restored files.
+// files changed after the command are not overwritten unless -f is given
+func (rec *journalRecord) restore(state map[string]string) (err error) {
+	for _, jf := range rec.Files {
+		if !jf.changed(state) {
+			continue
+		}
+		if !cfg.force {
+			return fmt.Errorf("%w: %s ('%s'). use -f to undo anyway", ErrJournalChanged, jf.Path, rec.Command)
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s has been changed after '%s'; the changes are lost\n", jf.Path, rec.Command)
+	}
+
+	t := newFileTransaction()
+	t.noJournal = true
+	defer t.discard()
+	for i, jf := range rec.Files {
+		if !jf.Existed {
+			t.removeFile(jf.Path)
+			state[jf.Path] = ""
+			continue
+		}
+		var data []byte
+		data, err = os.ReadFile(filepath.Join(rec.dir, fmt.Sprintf(journalFileFmt, i)))
+		if err != nil {
+			return
+		}
+		err = t.writeFile(jf.Path, data, jf.Mode)
+		if err != nil {
+			return
+		}
+		state[jf.Path] = contentHash(data)
+	}
+	return t.commit()
+}
+
+// list the journal records of a save
+func cmdHistory(ss *saveFileSelector) (err error) {
+	dir, err := ss.journalDir()
+	if err != nil {
+		return
+	}
+	list, err := readJournal(dir)
+	if err != nil {
+		return
+	}
+	if len(list) == 0 {
+		if cfg.verbose {
+			fmt.Printf("no history\n")
+		}
+		return
+	}
+	lines := make([]string, 0, len(list))
+	for i := len(list) - 1; i >= 0; i-- { // the latest first
+		rec := list[i]
+		lines = append(lines, fmt.Sprintf("#%d\000%s\000%d files\000%s", len(list)-i, rec.Time.Local().Format("2006-01-02 15:04:05"), len(rec.Files), rec.Command))
+	}
+	printAlignedLines(lines, "\000")
+	return
+}
+
+// restore the state before the last n commands modifying the saves
+func cmdUndo(ss *saveFileSelector, n int) (err error) {
+	dir, err := ss.journalDir()
+	if err != nil {
+		return
+	}
+	list, err := readJournal(dir)
+	if err != nil {
+		return
+	}
+	if len(list) == 0 {
+		return ErrNoJournal
+	}
+	if n > len(list) {
+		return fmt.Errorf("only %d operations can be undone", len(list))
+	}
+	state := make(map[string]string) // the files undone, to check the next record in a dry run
+	for i := 0; i < n; i++ {
+		rec := list[len(list)-1-i]
+		if cfg.verbose {
+			fmt.Printf("undoing '%s' at %s\n", rec.Command, rec.Time.Local().Format("2006-01-02 15:04:05"))
+		}
+		err = rec.restore(state)
+		if err != nil {
+			return
+		}
+		if cfg.dryRun {
+			continue
+		}
+		// remove the record from the journals of all directories
+		for _, d := range append(rec.Dirs, rec.dir) {
+			err = os.RemoveAll(d)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RFC 6902 JSON Patch for generic json values.
+// Values are decoded with decodeJsonValue(), so numbers are json.Number.
+//
+// JsonEx array wrappers ({"@c":id, "@a":[...]}) are transparent to JSON pointers;
+// an array index token applied to a wrapper object points to the element of the wrapped array,
+// i.e. "/switches/_data/12" is the same as "/switches/_data/@a/12".
+
+var (
+	ErrPatchPath = errors.New("patch path not found")
+	ErrPatchTest = errors.New("patch test failed")
+)
+
+// a JSON Patch document
+type jsonPatch []map[string]any
+
+// patch file for savefiles.
+// the file is either a JSON Patch document to be applied to the save body,
+// or an object {"body": PATCH, "index": PATCH} to patch the save body and/or the index entry.
+type savePatch struct {
+	Body  jsonPatch
+	Index jsonPatch
+}
+
+// read a patch file
+func readSavePatch(filename string) (p *savePatch, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	var v any
+	err = decodeJsonValue(data, &v)
+	if err != nil {
+		return
+	}
+	p = &savePatch{}
+	switch t := v.(type) {
+	case []any:
+		p.Body, err = toJsonPatch(t)
+	case map[string]any:
+		for k, pv := range t {
+			a, ok := pv.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s is not a JSON Patch", filename, k)
+			}
+			switch k {
+			case "body":
+				p.Body, err = toJsonPatch(a)
+			case "index":
+				p.Index, err = toJsonPatch(a)
+			default:
+				err = fmt.Errorf("unknown patch target: %s", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+	default:
+		err = fmt.Errorf("invalid patch file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return
+}
+
+// convert a decoded json array to a JSON Patch, validating each operation
+func toJsonPatch(a []any) (p jsonPatch, err error) {
+	p = make(jsonPatch, len(a))
+	for i, v := range a {
+		op, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("operation %d is not an object", i)
+		}
+		name, _ := op["op"].(string)
+		if _, ok := op["path"].(string); !ok {
+			return nil, fmt.Errorf("operation %d has no path", i)
+		}
+		_, hasValue := op["value"]
+		_, hasFrom := op["from"].(string)
+		switch name {
+		case "add", "replace", "test":
+			ok = hasValue
+		case "remove":
+			ok = true
+		case "move", "copy":
+			ok = hasFrom
+		default:
+			return nil, fmt.Errorf("operation %d has unknown op %q", i, name)
+		}
+		if !ok {
+			return nil, fmt.Errorf("operation %d (%s) has missing members", i, name)
+		}
+		p[i] = op
+	}
+	return
+}
+
+// parse a JSON pointer to reference tokens
+func parseJsonPointer(ptr string) (tokens []string, err error) {
+	if ptr == "" {
+		return []string{}, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer: %s", ptr)
+	}
+	tokens = strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return
+}
+
+// check whether the token is an array index or "-"
+func isArrayToken(tok string) bool {
+	if tok == "-" {
+		return true
+	}
+	_, err := arrayIndex(tok, -1)
+	return err == nil
+}
+
+// parse an array index token. if limit >= 0, the index must be <= limit.
+func arrayIndex(tok string, limit int) (i int, err error) {
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return -1, fmt.Errorf("%w: invalid index %q", ErrPatchPath, tok)
+	}
+	i, err = strconv.Atoi(tok)
+	if err != nil || i < 0 || (limit >= 0 && i > limit) {
+		return -1, fmt.Errorf("%w: invalid index %q", ErrPatchPath, tok)
+	}
+	return i, nil
+}
+
+// unwrap a JsonEx array wrapper, if the token is an array index not in the wrapper object
+func unwrapForToken(node any, tok string) (a []any, m map[string]any, ok bool) {
+	m, isMap := node.(map[string]any)
+	if !isMap {
+		return
+	}
+	a, isWrapper := m["@a"].([]any)
+	if !isWrapper || !isArrayToken(tok) {
+		return
+	}
+	if _, exists := m[tok]; exists {
+		return
+	}
+	return a, m, true
+}
+
+// get the value at the reference tokens
+func jsonPointerGet(node any, tokens []string) (v any, err error) {
+	for _, tok := range tokens {
+		if a, _, ok := unwrapForToken(node, tok); ok {
+			node = a
+		}
+		switch n := node.(type) {
+		case map[string]any:
+			var ok bool
+			node, ok = n[tok]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+			}
+		case []any:
+			var i int
+			i, err = arrayIndex(tok, len(n)-1)
+			if err != nil {
+				return
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+		}
+	}
+	return node, nil
+}
+
+// call fn with the container of the last token and the token, then store the container returned by fn.
+// returns the modified node.
+func jsonPointerEdit(node any, tokens []string, fn func(parent any, tok string) (any, error)) (any, error) {
+	tok := tokens[0]
+	if a, m, ok := unwrapForToken(node, tok); ok {
+		na, err := jsonPointerEdit(a, tokens, fn)
+		if err != nil {
+			return nil, err
+		}
+		m["@a"] = na
+		return m, nil
+	}
+	if len(tokens) == 1 {
+		return fn(node, tok)
+	}
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tok]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+		}
+		nc, err := jsonPointerEdit(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tok] = nc
+		return n, nil
+	case []any:
+		i, err := arrayIndex(tok, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		nc, err := jsonPointerEdit(n[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = nc
+		return n, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+}
+
+// add a value to the location
+func jsonPatchAdd(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonPointerEdit(doc, tokens, func(parent any, tok string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[tok] = value
+			return p, nil
+		case []any:
+			if tok == "-" {
+				return append(p, value), nil
+			}
+			i, err := arrayIndex(tok, len(p))
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+	})
+}
+
+// remove the value at the location
+func jsonPatchRemove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the root", ErrPatchPath)
+	}
+	return jsonPointerEdit(doc, tokens, func(parent any, tok string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			if _, ok := p[tok]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+			}
+			delete(p, tok)
+			return p, nil
+		case []any:
+			i, err := arrayIndex(tok, len(p)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(p[:i], p[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+	})
+}
+
+// replace the value at the location
+func jsonPatchReplace(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonPointerEdit(doc, tokens, func(parent any, tok string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			if _, ok := p[tok]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+			}
+			p[tok] = value
+			return p, nil
+		case []any:
+			i, err := arrayIndex(tok, len(p)-1)
+			if err != nil {
+				return nil, err
+			}
+			p[i] = value
+			return p, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPatchPath, tok)
+	})
+}
+
+// deep copy a generic json value
+func jsonDeepCopy(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for k, e := range t {
+			m[k] = jsonDeepCopy(e)
+		}
+		return m
+	case []any:
+		a := make([]any, len(t))
+		for i, e := range t {
+			a[i] = jsonDeepCopy(e)
+		}
+		return a
+	}
+	return v
+}
+
+// compare generic json values. numbers are compared by their values.
+func jsonEqual(a, b any) bool {
+	switch ta := a.(type) {
+	case map[string]any:
+		tb, ok := b.(map[string]any)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for k, v := range ta {
+			w, ok := tb[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		tb, ok := b.([]any)
+		if !ok || len(ta) != len(tb) {
+			return false
+		}
+		for i := range ta {
+			if !jsonEqual(ta[i], tb[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		tb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if ta == tb {
+			return true
+		}
+		fa, ea := ta.Float64()
+		fb, eb := tb.Float64()
+		return ea == nil && eb == nil && fa == fb
+	}
+	return a == b
+}
+
+// apply the patch to a document. the document may be modified even if an error is returned.
+func (p jsonPatch) apply(doc any) (any, error) {
+	for i, op := range p {
+		path, _ := op["path"].(string)
+		tokens, err := parseJsonPointer(path)
+		if err != nil {
+			return nil, err
+		}
+		var fromTokens []string
+		if from, ok := op["from"].(string); ok {
+			fromTokens, err = parseJsonPointer(from)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		name := op["op"].(string)
+		switch name {
+		case "add":
+			doc, err = jsonPatchAdd(doc, tokens, jsonDeepCopy(op["value"]))
+		case "remove":
+			doc, err = jsonPatchRemove(doc, tokens)
+		case "replace":
+			doc, err = jsonPatchReplace(doc, tokens, jsonDeepCopy(op["value"]))
+		case "move":
+			from := op["from"].(string)
+			if strings.HasPrefix(path, from+"/") {
+				return nil, fmt.Errorf("operation %d: cannot move a value into its child", i)
+			}
+			var v any
+			v, err = jsonPointerGet(doc, fromTokens)
+			if err == nil {
+				doc, err = jsonPatchRemove(doc, fromTokens)
+			}
+			if err == nil {
+				doc, err = jsonPatchAdd(doc, tokens, v)
+			}
+		case "copy":
+			var v any
+			v, err = jsonPointerGet(doc, fromTokens)
+			if err == nil {
+				doc, err = jsonPatchAdd(doc, tokens, jsonDeepCopy(v))
+			}
+		case "test":
+			var v any
+			v, err = jsonPointerGet(doc, tokens)
+			if err == nil && !jsonEqual(v, op["value"]) {
+				err = fmt.Errorf("%w: %s", ErrPatchTest, path)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, name, path, err)
+		}
+	}
+	return doc, nil
+}
+
+// apply patches to savefiles
+func cmdPatch(src []*saveFileSelector, patchFile string) (err error) {
+	p, err := readSavePatch(patchFile)
+	if err != nil {
+		return
+	}
+
+	total := 0
+	for _, ss := range src {
+		var entries []*saveEntry
+		entries, err = ss.readSaveAtPath(false, true)
+		if err != nil {
+			return
+		}
+		var count int
+		count, err = editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+			if cfg.verbose {
+				fmt.Printf("patching %s\n", ss.displayPath(se.Id))
+			}
+			if len(p.Body) > 0 {
+				var body saveBody
+				body, err = se.body()
+				if err != nil {
+					return
+				}
+				var doc any
+				doc, err = p.Body.apply(map[string]any(body))
+				if err != nil {
+					return
+				}
+				m, ok := doc.(map[string]any)
+				if !ok {
+					return false, fmt.Errorf("patched save body is not an object")
+				}
+				err = se.setBody(m)
+				if err != nil {
+					return
+				}
+			}
+			if len(p.Index) > 0 {
+				if se.IndexJson == nil {
+					return false, ErrNoData
+				}
+				var doc any
+				err = decodeJsonValue(se.IndexJson, &doc)
+				if err != nil {
+					return
+				}
+				doc, err = p.Index.apply(doc)
+				if err != nil {
+					return
+				}
+				se.IndexJson, err = encodeJsonOrdered(doc, readJsonOrder(se.IndexJson))
+				if err != nil {
+					return
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			return
+		}
+		total += count
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves patched\n", total)
+	}
+	return
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lockFileName = "lock" // advisory lock file in the hidden directory next to the saves
+
+	staleLockAge = 10 * time.Minute // age of a lock file considered stale, if the owner process cannot be checked
+)
+
+var (
+	ErrGameRunning = errors.New("the game seems to be running")
+	ErrLocked      = errors.New("the saves are being modified by another rpgmv-savetool")
+)
+
+// process names of rpg maker mv games. compared in lower case
+var gameProcessNames = map[string]bool{
+	"game":     true, // deployed linux or macos game
+	"game.exe": true, // windows game run with wine
+	"nw":       true, // nw.js
+	"nwjs":     true,
+	"nw.exe":   true,
+}
+
+// lock files held by this process
+var heldLocks = make(map[string]bool)
+
+// lock the directory of a save while the command is running.
+// for a rpg maker mv save directory, the game must not be running.
+func (ss *saveFileSelector) lock() (err error) {
+	dir, isRpgMvSave, err := detectSaveType(ss.Path)
+	if err != nil {
+		return
+	}
+	if !isRpgMvSave {
+		dir = filepath.Dir(dir)
+	}
+	if st, e := os.Stat(dir); e != nil || !st.IsDir() {
+		// a new directory; nothing to lock
+		return nil
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	lockFile := filepath.Join(dir, journalDirName, lockFileName)
+	if heldLocks[lockFile] {
+		return nil
+	}
+
+	if isRpgMvSave {
+		if pid, name := findRunningGame(dir); pid != 0 {
+			if !cfg.ignoreRunning {
+				return fmt.Errorf("%w (pid %d, %s). close the game, or use --ignore-running to modify the saves anyway", ErrGameRunning, pid, name)
+			}
+			fmt.Fprintf(os.Stderr, "warning: the game seems to be running (pid %d, %s); the game may overwrite the changes\n", pid, name)
+		}
+	}
+	if cfg.dryRun {
+		// do not write a lock file
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(lockFile), 0755)
+	if err != nil {
+		return
+	}
+	for retry := 0; ; retry++ {
+		var f *os.File
+		f, err = os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			if err != nil {
+				os.Remove(lockFile)
+				return
+			}
+			heldLocks[lockFile] = true
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) || retry > 0 {
+			break
+		}
+		// remove a lock left by a dead process, and retry
+		pid, alive := lockOwner(lockFile)
+		if alive {
+			return fmt.Errorf("%w (pid %d). remove %s if no other rpgmv-savetool is running", ErrLocked, pid, lockFile)
+		}
+		os.Remove(lockFile)
+	}
+	return fmt.Errorf("cannot lock the saves: %w", err)
+}
+
+// lock the saves of the selectors while a command modifying them is running
+func lockSaves(ssList ...*saveFileSelector) (err error) {
+	for _, ss := range ssList {
+		if ss == nil {
+			continue
+		}
+		err = ss.lock()
+		if err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// whether this process holds the lock of the directory of a file
+func holdsLock(filename string) bool {
+	dir, err := filepath.Abs(filepath.Dir(journalDirOf(filename)))
+	if err != nil {
+		return false
+	}
+	return heldLocks[filepath.Join(dir, lockFileName)]
+}
+
+// release all lock files held by this process
+func releaseLocks() {
+	for f := range heldLocks {
+		os.Remove(f)
+	}
+	heldLocks = make(map[string]bool)
+}
+
+// get the owner process of a lock file, and whether the process is alive
+func lockOwner(lockFile string) (pid int, alive bool) {
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		return 0, false
+	}
+	pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false
+	}
+	if runtime.GOOS == "linux" {
+		_, err = os.Stat(fmt.Sprintf("/proc/%d", pid))
+		return pid, err == nil
+	}
+	// the process cannot be checked; a recent lock is considered alive
+	st, err := os.Stat(lockFile)
+	return pid, err == nil && time.Since(st.ModTime()) < staleLockAge
+}
+
+// get the root directory of the game from the save directory; "GAME/www/save" or "GAME/save"
+func gameRootDir(saveDir string) string {
+	parent := filepath.Dir(filepath.Clean(saveDir))
+	if filepath.Base(parent) == "www" {
+		return filepath.Dir(parent)
+	}
+	return parent
+}
+
+// find a running game process using the game directory, via /proc on linux.
+// returns 0 if not found, or the running processes cannot be checked.
+func findRunningGame(saveDir string) (pid int, name string) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	root := gameRootDir(saveDir)
+	inGame := func(link string) bool {
+		p, err := os.Readlink(link)
+		if err != nil {
+			return false
+		}
+		rel, err := filepath.Rel(root, p)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+	for _, p := range procs {
+		id, err := strconv.Atoi(p.Name())
+		if err != nil || id == os.Getpid() {
+			continue
+		}
+		procDir := filepath.Join("/proc", p.Name())
+		comm, err := os.ReadFile(filepath.Join(procDir, "comm"))
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSpace(string(comm))
+		if !gameProcessNames[strings.ToLower(name)] {
+			continue
+		}
+		// the process runs in the game directory, or has a file of the game open
+		if inGame(filepath.Join(procDir, "cwd")) || inGame(filepath.Join(procDir, "exe")) {
+			return id, name
+		}
+		fds, _ := os.ReadDir(filepath.Join(procDir, "fd"))
+		for _, fd := range fds {
+			if inGame(filepath.Join(procDir, "fd", fd.Name())) {
+				return id, name
+			}
+		}
+	}
+	return 0, ""
+}
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	lzstring "github.com/mixcode/golib-lzstring"
 )
@@ -29,6 +32,29 @@ type config struct {
 
 	setComment bool // set comments to modifying entries
 	comment    string
+
+	dataDir string // game data directory
+
+	orderBy string // order of entries: "id", "timestamp", "playtime" or "map"
+	reverse bool   // reverse the order
+
+	dryRun bool // show what would be done without writing
+
+	maxSlots    int  // number of save slots shown in the game. 0 to detect from the game scripts
+	noSlotLimit bool // allow writing beyond the save slots of the game
+
+	ignoreRunning bool // modify the saves while the game is running
+
+	trashDays int // purge entries in the trash older than the days. 0 to keep
+
+	onConflict string // how to resolve conflicts of IDs: "ask", "skip", "overwrite", "rename", "newer" or "fail"
+
+	verify    bool // read back and check written files
+	setVerify bool // -verify is given. otherwise only rpg maker mv save directories are verified
+
+	unprotect bool // allow overwriting or removing protected entries
+
+	watchInterval time.Duration // polling interval of the watch command
 }
 
 var (
@@ -42,6 +68,7 @@ var (
 		useDefaultExt: true,
 		verbose:       true,
 		setComment:    false,
+		watchInterval: defaultWatchInterval,
 	}
 
 	// non-flag arguments
@@ -59,7 +86,7 @@ func getArg(n int) string {
 func run() (err error) {
 	cmd := getArg(0)
 	if cmd == "" {
-		err = fmt.Errorf("no command given. valid commands are 'ls', 'cp', 'mv', 'rm'. use -h for help")
+		err = fmt.Errorf("no command given. valid commands are 'ls', 'cp', 'mv', 'rm', 'set', 'party', 'actor', 'items', 'teleport', 'patch', 'edit', 'run', 'comment', 'tag', 'compact', 'swap', 'sort', 'history', 'undo', 'trash', 'protect', 'watch'. use -h for help")
 		return
 	}
 
@@ -88,6 +115,18 @@ func run() (err error) {
 	case "cp", "mv": // copy or move savefile between archives
 
 		a := args[1:]
+		if len(a) == 1 {
+			// an ID mapping within a file, FILENAME@SRCID,...=>DESTID,...
+			if src, dest, ok := splitIdMapping(a[0]); ok {
+				a = []string{src, dest}
+			}
+		}
+		for _, s := range a {
+			if strings.Contains(s, idMappingArrow) {
+				err = fmt.Errorf("an ID mapping (%s) must be the only argument", idMappingArrow)
+				return
+			}
+		}
 		if len(a) < 2 {
 			err = fmt.Errorf("please set source filenames and a destination filename and/or %cid", idSeparator)
 			return
@@ -109,6 +148,10 @@ func run() (err error) {
 				return
 			}
 		}
+		err = lockSaves(append(srcSS, destSS)...)
+		if err != nil {
+			return
+		}
 		if cmd == "cp" {
 			err = cmdCp(srcSS, destSS)
 		} else if cmd == "mv" {
@@ -131,12 +174,360 @@ func run() (err error) {
 			if err != nil {
 				return
 			}
+			err = lockSaves(ss)
+			if err != nil {
+				return
+			}
 			err = cmdRm(ss)
 			if err != nil {
 				return
 			}
 		}
 
+	case "set": // set game state values in savefiles
+		a := args[1:]
+		if len(a) < 2 {
+			err = fmt.Errorf("please provide a filename and/or %cid, and assignments", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdSet(ss, a[1:])
+
+	case "party": // modify party members
+		a := args[1:]
+		if len(a) == 0 {
+			err = fmt.Errorf("please provide a filename and/or %cid", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		var actors []string
+		if len(a) > 2 {
+			actors = a[2:]
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdParty(ss, getArg(2), actors)
+
+	case "actor": // modify an actor's status
+		a := args[1:]
+		if len(a) < 3 {
+			err = fmt.Errorf("please provide a filename and/or %cid, an actor, and assignments", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdActor(ss, a[1], a[2:])
+
+	case "items": // list or modify the party inventory
+		a := args[1:]
+		if len(a) == 0 {
+			err = fmt.Errorf("please provide a filename and/or %cid", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		var items []string
+		if len(a) > 2 {
+			items = a[2:]
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdItems(ss, getArg(2), items)
+
+	case "teleport": // move the player
+		a := args[1:]
+		if len(a) < 2 {
+			err = fmt.Errorf("please provide a filename and/or %cid, and the destination", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdTeleport(ss, a[1:])
+
+	case "patch": // apply a JSON Patch to savefiles
+		a := args[1:]
+		if len(a) < 2 {
+			err = fmt.Errorf("please provide filenames and/or %cid, and a patch file", idSeparator)
+			return
+		}
+
+		// the last arg is the patch file
+		patchFile, a := a[len(a)-1], a[:len(a)-1]
+		srcSS := make([]*saveFileSelector, len(a))
+		for i, s := range a {
+			srcSS[i], err = NewSaveFileSelector(s)
+			if err != nil {
+				return
+			}
+		}
+		err = lockSaves(srcSS...)
+		if err != nil {
+			return
+		}
+		err = cmdPatch(srcSS, patchFile)
+
+	case "edit": // edit savefiles with the editor
+		if len(args) < 2 {
+			err = fmt.Errorf("please provide a filename and/or %cid", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(args[1])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdEdit(ss)
+
+	case "run": // run a script on savefiles
+		a := args[1:]
+		if len(a) < 2 {
+			err = fmt.Errorf("please provide a script file, and filenames and/or %cid", idSeparator)
+			return
+		}
+		srcSS := make([]*saveFileSelector, len(a)-1)
+		for i, s := range a[1:] {
+			srcSS[i], err = NewSaveFileSelector(s)
+			if err != nil {
+				return
+			}
+		}
+		err = lockSaves(srcSS...)
+		if err != nil {
+			return
+		}
+		err = cmdRun(a[0], srcSS)
+
+	case "comment": // set, append or clear comments of archive entries
+		a := args[1:]
+		if len(a) < 2 {
+			err = fmt.Errorf("please provide a filename and/or %cid, and 'set', 'append' or 'clear'", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdComment(ss, a[1], strings.Join(a[2:], " "))
+
+	case "tag": // add or remove tags of archive entries
+		a := args[1:]
+		if len(a) == 0 {
+			err = fmt.Errorf("please provide a filename and/or %cid", idSeparator)
+			return
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		var tags []string
+		if len(a) > 2 {
+			tags = a[2:]
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdTag(ss, getArg(2), tags)
+
+	case "compact": // renumber entries without gaps
+		a := args[1:]
+		if len(a) == 0 {
+			a = append(a, ".")
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdCompact(ss, getArg(2))
+
+	case "sort": // reorder entries
+		a := args[1:]
+		if len(a) == 0 {
+			a = append(a, ".")
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdSort(ss)
+
+	case "swap": // exchange two entries
+		a := args[1:]
+		if len(a) != 2 {
+			err = fmt.Errorf("please provide two filenames and/or %cid to swap", idSeparator)
+			return
+		}
+		var ssA, ssB *saveFileSelector
+		ssA, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		ssB, err = NewSaveFileSelector(a[1])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ssA, ssB)
+		if err != nil {
+			return
+		}
+		err = cmdSwap(ssA, ssB)
+
+	case "history": // list the journal of modifications
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(getArg(1))
+		if err != nil {
+			return
+		}
+		err = cmdHistory(ss)
+
+	case "undo": // restore the state before the last modifications
+		a := args[1:]
+		if len(a) == 1 {
+			if _, e := strconv.Atoi(a[0]); e == nil {
+				// only the number is given
+				a = []string{"", a[0]}
+			}
+		}
+		n := 1
+		if len(a) > 1 {
+			n, err = strconv.Atoi(a[1])
+			if err != nil || n <= 0 {
+				err = fmt.Errorf("invalid number of operations: %s", a[1])
+				return
+			}
+		}
+		path := ""
+		if len(a) > 0 {
+			path = a[0]
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(path)
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdUndo(ss, n)
+
+	case "trash": // list, restore or empty deleted saves
+		a := args[1:]
+		op, path, destPath := getArg(1), "", ""
+		if len(a) > 1 {
+			path = a[1]
+		}
+		if len(a) > 2 {
+			destPath = a[2]
+		}
+		var ss, destSS *saveFileSelector
+		ss, err = NewSaveFileSelector(path)
+		if err != nil {
+			return
+		}
+		if op == "restore" && ss.AllIds {
+			err = fmt.Errorf("please provide %cid of the trash entries to restore", idSeparator)
+			return
+		}
+		if destPath != "" {
+			destSS, err = NewSaveFileSelector(destPath)
+			if err != nil {
+				return
+			}
+		}
+		if op != "" && op != "ls" {
+			err = lockSaves(ss, destSS)
+			if err != nil {
+				return
+			}
+		}
+		err = cmdTrash(op, ss, destSS)
+
+	case "protect": // protect entries against overwriting and removal
+		a := args[1:]
+		if len(a) == 0 {
+			a = append(a, ".")
+		}
+		var ss *saveFileSelector
+		ss, err = NewSaveFileSelector(a[0])
+		if err != nil {
+			return
+		}
+		err = lockSaves(ss)
+		if err != nil {
+			return
+		}
+		err = cmdProtect(ss, getArg(2))
+
+	case "watch": // copy savefiles to an archive whenever the game writes them
+		if len(args) < 3 {
+			err = fmt.Errorf("please provide a save directory and an archive file")
+			return
+		}
+		var ss, destSS *saveFileSelector
+		ss, err = NewSaveFileSelector(getArg(1))
+		if err != nil {
+			return
+		}
+		destSS, err = NewSaveFileSelector(getArg(2))
+		if err != nil {
+			return
+		}
+		err = cmdWatch(ss, destSS)
+
 	case "d", "e": // "d" and "e" is hidden commands for decoding and encoding lzstring file
 		src, dest := getArg(1), getArg(2)
 		if src == "" {
@@ -176,24 +567,12 @@ var (
 
 func parseFlags() (err error) {
 
-	// separate args and flags
-	flagArgs := make([]string, 0)
-	args = make([]string, 0)
 	help := false
 	for _, a := range os.Args[1:] {
 		if (len(a) >= 2 && a[:2] == "-h") || (len(a) >= 3 && a[:3] == "--h") {
 			help = true
 			break
 		}
-		var c byte
-		if len(a) > 0 {
-			c = a[0]
-		}
-		if c == '-' {
-			flagArgs = append(flagArgs, a)
-		} else {
-			args = append(args, a)
-		}
 	}
 
 	// set normal flags
@@ -207,9 +586,23 @@ func parseFlags() (err error) {
 	fs.BoolVar(&quiet, "q", !cfg.verbose, "quiet. suppress non-error messages")
 	fs.BoolVar(&cfg.useDefaultExt, "x", cfg.useDefaultExt, fmt.Sprintf("add extension (%s) to file if no extension found", extRpgArchive))
 	fs.StringVar(&cfg.comment, "c", "", "set comment to modifying savefiles")
+	fs.StringVar(&cfg.dataDir, "d", cfg.dataDir, "game data directory (www/data) used to look up names")
+	fs.StringVar(&cfg.orderBy, "by", cfg.orderBy, "order of saves for sort and compact: 'id', 'timestamp', 'playtime' or 'map'")
+	fs.BoolVar(&cfg.reverse, "r", cfg.reverse, "reverse the order of saves for sort and compact")
+	fs.IntVar(&cfg.maxSlots, "slots", cfg.maxSlots, "number of save slots of the game. detected from the game scripts if not set")
+	fs.BoolVar(&cfg.noSlotLimit, "no-slot-limit", cfg.noSlotLimit, "allow writing saves beyond the save slots of the game")
+	fs.StringVar(&cfg.onConflict, "on-conflict", cfg.onConflict, "how to resolve an existing entry at the destination: "+strings.Join(conflictPolicies, "|")+". -f is same as 'overwrite'")
+	fs.IntVar(&cfg.trashDays, "trash-days", cfg.trashDays, "purge saves in the trash older than the days")
+	fs.BoolVar(&cfg.dryRun, "n", cfg.dryRun, "dry run. show what would be done without writing files")
+	fs.DurationVar(&cfg.watchInterval, "interval", cfg.watchInterval, "polling interval of the watch command")
+	fs.BoolVar(&cfg.ignoreRunning, "ignore-running", cfg.ignoreRunning, "modify saves even if the game seems to be running")
+	fs.BoolVar(&cfg.unprotect, "unprotect", cfg.unprotect, "allow overwriting, moving or removing protected saves")
+	fs.BoolVar(&cfg.verify, "verify", cfg.verify, "read back and check written files, and restore a mismatched file from the staged copy. on by default for save directories")
 
 	// alternative flags
 	fs.Bool("no-default-ext", false, "same as '-x=false'")
+	fs.Bool("dry-run", false, "same as '-n'")
+	fs.Bool("no-verify", false, "same as '-verify=false'")
 	//fs.Bool("no-gap", false, "same as '-k=false'")
 
 	// show helps
@@ -224,6 +617,27 @@ func parseFlags() (err error) {
 
 	fs.SetOutput(io.Discard) // disable output to prevent error and usage printing, which may reveals hidden commands.
 
+	// separate args and flags. a flag taking a value may have the value in the next argument, i.e. "-c TEXT"
+	flagArgs := make([]string, 0)
+	args = make([]string, 0)
+	osArgs := os.Args[1:]
+	for i := 0; i < len(osArgs); i++ {
+		a := osArgs[i]
+		if len(a) == 0 || a[0] != '-' {
+			args = append(args, a)
+			continue
+		}
+		flagArgs = append(flagArgs, a)
+		name := strings.TrimLeft(a, "-")
+		if strings.Contains(name, "=") || i+1 >= len(osArgs) {
+			continue
+		}
+		if f := fs.Lookup(name); f != nil && !isBoolFlag(f) {
+			i++
+			flagArgs = append(flagArgs, osArgs[i])
+		}
+	}
+
 	// parse flags
 	err = fs.Parse(flagArgs)
 	if err != nil {
@@ -238,6 +652,16 @@ func parseFlags() (err error) {
 			// comment has set
 			cfg.setComment = true // turn comment-modify flag ON
 
+		case "dry-run":
+			if f.Value.String() == "true" {
+				cfg.dryRun = true
+			}
+		case "verify":
+			cfg.setVerify = true
+		case "no-verify":
+			if f.Value.String() == "true" {
+				cfg.verify, cfg.setVerify = false, true
+			}
 		case "no-default-ext":
 			if f.Value.String() == "true" {
 				cfg.useDefaultExt = false
@@ -251,9 +675,27 @@ func parseFlags() (err error) {
 			cfg.verbose = (f.Value.String() == "true")
 		}
 	})
+	if cfg.dryRun {
+		cfg.verbose = true // show the plan
+	}
+	if cfg.watchInterval <= 0 {
+		return fmt.Errorf("invalid interval: %s", cfg.watchInterval)
+	}
+	if cfg.onConflict != "" {
+		cfg.onConflict, err = parseConflictPolicy(cfg.onConflict)
+		if err != nil {
+			return
+		}
+	}
 	return nil
 }
 
+// check whether a flag takes no value
+func isBoolFlag(f *flag.Flag) bool {
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
+
 func main() {
 
 	err := parseFlags()
@@ -261,6 +703,7 @@ func main() {
 	if err == nil {
 		// execute the main function
 		err = run()
+		releaseLocks()
 	}
 
 	if err != nil && err != ErrShowHelp {
@@ -1,5 +1,17 @@
 package main
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
 //
 // TODO: create test cases for cp, mv, rm
 //
@@ -20,3 +32,1102 @@ func TestYn(t *testing.T) {
 	fmt.Printf("%v", promptYN("default false", false))
 }
 */
+
+// decode a json text for tests
+func mustJson(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := decodeJsonValue([]byte(s), &v); err != nil {
+		t.Fatalf("invalid json %s: %v", s, err)
+	}
+	return v
+}
+
+func TestJsonPatch(t *testing.T) {
+	cases := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string // expected document; empty if an error is expected
+		err   error  // expected error, if any
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, nil},
+		{"add array element", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, nil},
+		{"add to the end", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, nil},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, nil},
+		{"remove", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, nil},
+		{"remove missing", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, ``, ErrPatchPath},
+		{"replace missing", `{"a":1}`, `[{"op":"replace","path":"/b","value":1}]`, ``, ErrPatchPath},
+		{"move", `{"a":{"x":1},"b":{}}`, `[{"op":"move","from":"/a/x","path":"/b/y"}]`, `{"a":{},"b":{"y":1}}`, nil},
+		{"copy", `{"a":[1]}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":[1],"b":[1]}`, nil},
+		{"test passes", `{"a":1.0}`, `[{"op":"test","path":"/a","value":1},{"op":"add","path":"/b","value":0}]`, `{"a":1.0,"b":0}`, nil},
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ``, ErrPatchTest},
+		{"escaped pointer", `{"a/b":1,"c~d":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/c~0d"}]`, `{}`, nil},
+		{"jsonex array", `{"s":{"@c":3,"@a":[null,false]}}`, `[{"op":"replace","path":"/s/1","value":true}]`, `{"s":{"@c":3,"@a":[null,true]}}`, nil},
+		{"jsonex array explicit", `{"s":{"@c":3,"@a":[null,false]}}`, `[{"op":"replace","path":"/s/@a/1","value":true}]`, `{"s":{"@c":3,"@a":[null,true]}}`, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := toJsonPatch(mustJson(t, c.patch).([]any))
+			if err != nil {
+				t.Fatalf("toJsonPatch: %v", err)
+			}
+			got, err := p.apply(mustJson(t, c.doc))
+			if c.want == "" {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				if c.err != nil && !errors.Is(err, c.err) {
+					t.Fatalf("expected %v, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if !jsonEqual(got, mustJson(t, c.want)) {
+				t.Errorf("got %s, want %s", jsonString(got), c.want)
+			}
+		})
+	}
+}
+
+func TestJsonPatchInvalid(t *testing.T) {
+	cases := []string{
+		`[1]`,
+		`[{"op":"add","value":1}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"move","path":"/a"}]`,
+		`[{"op":"unknown","path":"/a"}]`,
+	}
+	for _, c := range cases {
+		if _, err := toJsonPatch(mustJson(t, c).([]any)); err == nil {
+			t.Errorf("%s: expected an error", c)
+		}
+	}
+}
+
+// a minimal save body for script tests
+const testScriptBody = `{
+	"switches": {"@": "Game_Switches", "@c": 1, "_data": {"@a": [null, false, true]}},
+	"variables": {"@": "Game_Variables", "@c": 2, "_data": {"@a": [null, 0, 5]}},
+	"selfSwitches": {"@": "Game_SelfSwitches", "@c": 3, "_data": {"@": "Object", "3,7,A": true}},
+	"party": {"@": "Game_Party", "@c": 4, "_gold": 100, "_steps": 0, "_items": {"1": 3}, "_weapons": {}, "_armors": {}}
+}`
+
+func TestScript(t *testing.T) {
+	cases := []struct {
+		name    string
+		src     string
+		want    map[string]string // JSON pointer => expected value. "null" for a missing value
+		changes int
+	}{
+		{"assign", `variables[1] = 3`, map[string]string{"/variables/_data/1": `3`}, 1},
+		{"compound", `variables[2] += 2; variables[2] *= 3`, map[string]string{"/variables/_data/2": `21`}, 1},
+		{"floor", `variables[1] = 7 / 2`, map[string]string{"/variables/_data/1": `3`}, 1},
+		{"grow array", `switches[4] = true`, map[string]string{"/switches/_data/4": `true`, "/switches/_data/3": `null`}, 1},
+		{"truthy", `switches[1] = "x"; switches[2] = 0`, map[string]string{"/switches/_data/1": `true`, "/switches/_data/2": `false`}, 2},
+		{"if else", `if switches[2] { gold = gold * 2 } else { gold = 0 }`, map[string]string{"/party/_gold": `200`}, 1},
+		{"else if", "if switches[1] { steps = 1 } else if variables[2] >= 5 { steps = 2 } else { steps = 3 }", map[string]string{"/party/_steps": `2`}, 1},
+		{"precedence", `variables[1] = 1 + 2 * 3 - -1`, map[string]string{"/variables/_data/1": `8`}, 1},
+		{"logical", `switches[1] = switches[2] && !selfswitches["3,7,A"] || variables[2] == 5`, map[string]string{"/switches/_data/1": `true`}, 1},
+		{"string compare", `switches[1] = "abc" < "abd"`, map[string]string{"/switches/_data/1": `true`}, 1},
+		{"gold limit", `gold = 123456789`, map[string]string{"/party/_gold": `99999999`}, 1},
+		{"remove item", `items[1] -= 5; items[2] = 1`, map[string]string{"/party/_items/1": `null`, "/party/_items/2": `1`}, 2},
+		{"self switch off", `selfswitches["3,7,A"] = false`, map[string]string{"/selfSwitches/_data/3,7,A": `null`}, 1},
+		{"comments", "# comment\n// comment\nvariables[1] = 1 # trailing", map[string]string{"/variables/_data/1": `1`}, 1},
+		{"restored value", `gold = 1; gold = 100`, map[string]string{"/party/_gold": `100`}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := parseScript(c.src)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			body := saveBody(mustJson(t, testScriptBody).(map[string]any))
+			changes, err := s.run(body, nil)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if len(changes) != c.changes {
+				t.Errorf("%d changes, want %d", len(changes), c.changes)
+			}
+			for ptr, want := range c.want {
+				tokens, _ := parseJsonPointer(ptr)
+				got, err := jsonPointerGet(map[string]any(body), tokens)
+				if err != nil {
+					got = nil
+				}
+				if !jsonEqual(got, mustJson(t, want)) {
+					t.Errorf("%s = %s, want %s", ptr, jsonString(got), want)
+				}
+			}
+		})
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		err  error
+	}{
+		{"missing value", `gold =`, ErrScriptSyntax},
+		{"unclosed block", `if gold > 1 { gold = 1`, ErrScriptSyntax},
+		{"unclosed string", `variables[1] = "abc`, nil},
+		{"unknown name", `foo = 1`, nil},
+		{"missing index", `switches = 1`, nil},
+		{"unexpected index", `gold[1] = 1`, nil},
+		{"division by zero", `gold = 1 / 0`, ErrScriptRuntime},
+		{"invalid operands", `gold = 1 - "a"`, ErrScriptRuntime},
+		{"invalid self switch", `selfswitches["x"] = true`, ErrScriptRuntime},
+		{"not a number", `gold = "a"`, ErrScriptRuntime},
+		{"name without game data", `switches["Boss"] = true`, nil},
+		{"huge switch id", `switches[1000000000] = true`, ErrScriptRuntime},
+		{"huge variable id", `variables[1000000000000000000] = 1`, ErrScriptRuntime},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := parseScript(c.src)
+			if err == nil {
+				body := saveBody(mustJson(t, testScriptBody).(map[string]any))
+				_, err = s.run(body, nil)
+			}
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if c.err != nil && !errors.Is(err, c.err) {
+				t.Fatalf("expected %v, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestParsePathIndex(t *testing.T) {
+	cur := "." + string(os.PathSeparator)
+	cases := []struct {
+		in        string
+		path      string
+		ids       []int
+		openStart int
+		err       bool
+	}{
+		{"backup.rpgarch", "backup.rpgarch", nil, 1, false},
+		{"", cur, nil, 1, false},
+		{"@3", cur, []int{3}, idNotOpenEnded, false},
+		{"save@1,3,5", "save", []int{1, 3, 5}, idNotOpenEnded, false},
+		{"save@5,1,3", "save", []int{5, 1, 3}, idNotOpenEnded, false},
+		{"save@1-3", "save", []int{1, 2, 3}, idNotOpenEnded, false},
+		{"save@3-1", "save", []int{3, 2, 1}, idNotOpenEnded, false},
+		{"save@7,1-2", "save", []int{7, 1, 2}, idNotOpenEnded, false},
+		{"save@10-", "save", []int{}, 10, false},
+		{"save@2,5-", "save", []int{2}, 5, false},
+		{"save#4", "save", []int{4}, idNotOpenEnded, false},
+		{"save/file12.rpgsave", "save/", []int{12}, idNotOpenEnded, false},
+		{"save@1,1", "", nil, 0, true},
+		{"save@1-3,2", "", nil, 0, true},
+		{"save@3-,5", "", nil, 0, true},
+		{"save@5,3-", "", nil, 0, true},
+	}
+	for _, c := range cases {
+		path, ids, openStart, err := parsePathIndex(c.in)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if path != c.path || !reflect.DeepEqual(ids, c.ids) || openStart != c.openStart {
+			t.Errorf("%q: got %q %v %d, want %q %v %d", c.in, path, ids, openStart, c.path, c.ids, c.openStart)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	cases := []struct {
+		in       string
+		selected []int // IDs in 1..10 selected
+		next     []int // the first IDs generated by NextId()
+	}{
+		{"s@5,1,3", []int{1, 3, 5}, []int{5, 1, 3}},
+		{"s@3-1", []int{1, 2, 3}, []int{3, 2, 1}},
+		{"s@2,8-", []int{2, 8, 9, 10}, []int{2, 8, 9, 10, 11}},
+		{"s", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int{1, 2, 3}},
+	}
+	for _, c := range cases {
+		path, ids, openStart, err := parsePathIndex(c.in)
+		if err != nil {
+			t.Fatalf("%q: %v", c.in, err)
+		}
+		ss := &saveFileSelector{Path: path, IdList: ids, OpenStart: openStart}
+		ss.ResetId()
+		selected := make([]int, 0)
+		for id := 1; id <= 10; id++ {
+			if ss.selects(id) {
+				selected = append(selected, id)
+			}
+		}
+		if !reflect.DeepEqual(selected, c.selected) {
+			t.Errorf("%q: selects %v, want %v", c.in, selected, c.selected)
+		}
+		next := make([]int, 0)
+		for len(next) < len(c.next) {
+			id, ok := ss.NextId()
+			if !ok {
+				break
+			}
+			next = append(next, id)
+		}
+		if !reflect.DeepEqual(next, c.next) {
+			t.Errorf("%q: NextId %v, want %v", c.in, next, c.next)
+		}
+	}
+}
+
+func TestSplitIdMapping(t *testing.T) {
+	cases := []struct {
+		in, src, dest string
+		ok            bool
+	}{
+		{"save@1,2=>5,6", "save@1,2", "save@5,6", true},
+		{"@11,13=>13,11", "@11,13", "@13,11", true},
+		{"save@1,2", "save@1,2", "", false},
+		{"save=>x", "save=>x", "", false},
+	}
+	for _, c := range cases {
+		src, dest, ok := splitIdMapping(c.in)
+		if src != c.src || dest != c.dest || ok != c.ok {
+			t.Errorf("%q: got %q %q %v, want %q %q %v", c.in, src, dest, ok, c.src, c.dest, c.ok)
+		}
+	}
+}
+
+// read the files of a directory for tests
+func readDirFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	fl, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fl {
+		if f.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name()] = string(data)
+	}
+	return files
+}
+
+func TestTransaction(t *testing.T) {
+	type op struct {
+		name, data string // empty data to remove the file
+	}
+	cases := []struct {
+		name  string
+		files map[string]string
+		ops   []op
+		fail  bool // make the last operation fail
+		want  map[string]string
+	}{
+		{"write", map[string]string{"a": "1"},
+			[]op{{"a", "2"}, {"b", "3"}}, false,
+			map[string]string{"a": "2", "b": "3"}},
+		{"remove", map[string]string{"a": "1", "b": "2"},
+			[]op{{"a", ""}, {"c", ""}}, false,
+			map[string]string{"b": "2"}},
+		{"leftover", map[string]string{"a": "1", ".a.tmp-123": "2"},
+			[]op{{"a", "3"}}, false,
+			map[string]string{"a": "3", ".a.tmp-123": "2"}},
+		{"rollback write", map[string]string{"a": "1"},
+			[]op{{"a", "2"}, {"b", "3"}, {"sub/c", "4"}}, true,
+			map[string]string{"a": "1"}},
+		{"rollback remove", map[string]string{"a": "1", "b": "2"},
+			[]op{{"a", ""}, {"b", "3"}, {"sub/c", "4"}}, true,
+			map[string]string{"a": "1", "b": "2"}},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		for name, data := range c.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		os.Mkdir(filepath.Join(dir, "sub"), 0755)
+
+		txn := newFileTransaction()
+		txn.noJournal = true
+		for _, o := range c.ops {
+			if o.data == "" {
+				txn.removeFile(filepath.Join(dir, o.name))
+				continue
+			}
+			if err := txn.writeFile(filepath.Join(dir, o.name), []byte(o.data), 0644); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+		if c.fail {
+			// the staged file of the last operation cannot be renamed
+			os.RemoveAll(filepath.Join(dir, "sub"))
+		}
+		err := txn.commit()
+		if (err != nil) != c.fail {
+			t.Errorf("%s: commit returned %v", c.name, err)
+		}
+		os.RemoveAll(filepath.Join(dir, "sub"))
+		if got := readDirFiles(t, dir); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a": "1", ".a.tmp-123": "2", ".a.bak-456": "3", ".b.tmp-789": "4"}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lockFile := filepath.Join(dir, journalDirName, lockFileName)
+	heldLocks[lockFile] = true
+	defer delete(heldLocks, lockFile)
+
+	txn := newFileTransaction()
+	txn.noJournal = true
+	if err := txn.writeFile(filepath.Join(dir, "a"), []byte("5"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.commit(); err != nil {
+		t.Fatal(err)
+	}
+	// only the temporary file of the target is removed; backups are kept to be restored by hand
+	want := map[string]string{"a": "5", ".a.bak-456": "3", ".b.tmp-789": "4"}
+	if got := readDirFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	testConfig(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := os.WriteFile(a, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// two commands: a=2, then a=3 and b=4
+	for _, files := range []map[string]string{{a: "2"}, {a: "3", b: "4"}} {
+		txn := newFileTransaction()
+		for name, data := range files {
+			if err := txn.writeFile(name, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := txn.commit(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond) // records are named by the time
+	}
+	ss, err := NewSaveFileSelector(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "3", "b": "4"}
+
+	// a dry run checks the second record against the files restored by the first
+	cfg.dryRun = true
+	if err := cmdUndo(ss, 2); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if got := readDirFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run: got %v, want %v", got, want)
+	}
+	cfg.dryRun = false
+
+	// a file changed after the last command is not overwritten
+	if err := os.WriteFile(b, []byte("5"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmdUndo(ss, 2); !errors.Is(err, ErrJournalChanged) {
+		t.Errorf("changed file: got %v, want %v", err, ErrJournalChanged)
+	}
+	if err := os.WriteFile(b, []byte("4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmdUndo(ss, 2); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"a": "1"}
+	if got := readDirFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := cmdUndo(ss, 1); !errors.Is(err, ErrNoJournal) {
+		t.Errorf("empty journal: got %v, want %v", err, ErrNoJournal)
+	}
+}
+
+func TestAllIds(t *testing.T) {
+	cases := []struct {
+		in   string
+		want bool
+	}{
+		{"", true},
+		{"save", true},
+		{"save/", true},
+		{"save@1-", false},
+		{"@1-", false},
+		{"save/file1.rpgsave", false},
+		{"@latest", false},
+		{"save@tag:boss", false},
+	}
+	for _, c := range cases {
+		ss, err := NewSaveFileSelector(c.in)
+		if err != nil {
+			t.Fatalf("%q: %v", c.in, err)
+		}
+		if ss.AllIds != c.want {
+			t.Errorf("%q: AllIds %v, want %v", c.in, ss.AllIds, c.want)
+		}
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	older := &saveEntry{Id: 1, IndexJson: []byte(`{"timestamp":1000}`)}
+	newer := &saveEntry{Id: 2, IndexJson: []byte(`{"timestamp":2000}`)}
+	protected := &saveEntry{Id: 1, IndexJson: []byte(`{"timestamp":1000}`), Protected: true}
+	cases := []struct {
+		policy        string
+		existing, src *saveEntry
+		unprotect     bool
+		id            int
+		ok            bool
+		err           error
+	}{
+		{conflictOverwrite, older, newer, false, 5, true, nil},
+		{conflictSkip, older, newer, false, 5, false, nil},
+		{conflictRename, older, newer, false, idFreeSlot, true, nil},
+		{conflictNewer, older, newer, false, 5, true, nil},
+		{conflictNewer, newer, older, false, 5, false, nil},
+		{conflictFail, older, newer, false, 5, false, ErrConflict},
+		{conflictOverwrite, protected, newer, false, 5, false, ErrProtected},
+		{conflictOverwrite, protected, newer, true, 5, true, nil},
+		{conflictNewer, protected, newer, false, 5, false, ErrProtected},
+		{conflictSkip, protected, newer, false, 5, false, nil},
+		{conflictRename, protected, newer, false, idFreeSlot, true, nil},
+		{conflictAsk, protected, newer, false, 5, false, ErrProtected},
+	}
+	saved := cfg
+	defer func() { cfg = saved }()
+	cfg.verbose = false
+	dest := &saveFileSelector{Path: "save.rpgarch", NormalizedPath: "save.rpgarch"}
+	for _, c := range cases {
+		cfg.onConflict, cfg.unprotect = c.policy, c.unprotect
+		id, ok, err := resolveConflict(dest, 5, c.existing, c.src, "src")
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got error %v, want %v", c.policy, err, c.err)
+			continue
+		}
+		if err == nil && (id != c.id || ok != c.ok) {
+			t.Errorf("%s: got %d %v, want %d %v", c.policy, id, ok, c.id, c.ok)
+		}
+	}
+}
+
+func TestNextFreeId(t *testing.T) {
+	used := map[int]bool{3: true, 4: true, 6: true}
+	cases := []struct{ id, want int }{
+		{3, 5},
+		{4, 5},
+		{5, 7},
+		{6, 7},
+		{1, 2},
+	}
+	for _, c := range cases {
+		if got := nextFreeId(c.id, func(id int) bool { return used[id] }); got != c.want {
+			t.Errorf("nextFreeId(%d) = %d, want %d", c.id, got, c.want)
+		}
+	}
+}
+
+func TestVerifyRollback(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("1"), 0644)
+	os.WriteFile(b, []byte("2"), 0644)
+
+	saved := cfg
+	defer func() { cfg = saved }()
+	cfg.dryRun = false
+	txn := newFileTransaction()
+	txn.noJournal = true
+	txn.writeFile(a, []byte("3"), 0644)
+	txn.writeFile(b, []byte("4"), 0644)
+	checked := 0
+	txn.verifyWith(b, func(data []byte) error {
+		checked++
+		return errors.New("mismatch")
+	})
+	err := txn.commit()
+	if !errors.Is(err, ErrVerify) {
+		t.Fatalf("commit returned %v, want %v", err, ErrVerify)
+	}
+	if checked != 2 {
+		t.Errorf("checked %d times, want 2", checked)
+	}
+	if got, want := readDirFiles(t, dir), map[string]string{"a": "1", "b": "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGrowArray(t *testing.T) {
+	cases := []struct {
+		len, n  int
+		wantLen int
+		err     error
+	}{
+		{3, 1, 3, nil},
+		{3, 5, 6, nil},
+		{0, maxArrayIndex, maxArrayIndex + 1, nil},
+		{0, maxArrayIndex + 1, 0, ErrInvalidId},
+		{0, 1000000000, 0, ErrInvalidId},
+		{0, -1, 0, ErrInvalidId},
+	}
+	for _, c := range cases {
+		a, err := growArray(make([]any, c.len), c.n)
+		if !errors.Is(err, c.err) {
+			t.Errorf("growArray(%d, %d): got error %v, want %v", c.len, c.n, err, c.err)
+			continue
+		}
+		if err == nil && len(a) != c.wantLen {
+			t.Errorf("growArray(%d, %d): got length %d, want %d", c.len, c.n, len(a), c.wantLen)
+		}
+	}
+}
+
+func TestJsonOrder(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		edit func(m map[string]any)
+		want string
+	}{
+		{"unchanged", `{"z":1,"@":"Game_X","a":{"y":[1,{"q":1,"b":2}],"c":"あ"}}`, func(m map[string]any) {},
+			`{"z":1,"@":"Game_X","a":{"y":[1,{"q":1,"b":2}],"c":"あ"}}`},
+		{"value changed", `{"z":1,"a":{"y":2,"b":3}}`, func(m map[string]any) { m["a"].(map[string]any)["b"] = 4 },
+			`{"z":1,"a":{"y":2,"b":4}}`},
+		{"member added", `{"z":1,"m":2}`, func(m map[string]any) { m["d"], m["b"] = 3, map[string]any{"y": 1, "x": 2} },
+			`{"z":1,"m":2,"b":{"x":2,"y":1},"d":3}`},
+		{"member removed", `{"z":1,"m":2,"a":3}`, func(m map[string]any) { delete(m, "m") },
+			`{"z":1,"a":3}`},
+		{"array grown", `{"a":[{"z":1,"b":2}]}`, func(m map[string]any) {
+			m["a"] = append(m["a"].([]any), map[string]any{"z": 3, "b": 4})
+		}, `{"a":[{"z":1,"b":2},{"b":4,"z":3}]}`},
+	}
+	for _, c := range cases {
+		m := mustJson(t, c.in).(map[string]any)
+		c.edit(m)
+		got, err := encodeJsonOrdered(m, readJsonOrder([]byte(c.in)))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestUpdatePartyIndex(t *testing.T) {
+	actor := func(id int, hidden bool) string {
+		return fmt.Sprintf(`{"@":"Game_Actor","_characterName":"A","_characterIndex":%d,"_faceName":"F","_faceIndex":%d,"_hidden":%v}`, id, id, hidden)
+	}
+	cases := []struct {
+		name    string
+		members string
+		hidden  map[int]bool
+		want    []int // character indices in the index
+	}{
+		{"all shown", "[1,2,3]", nil, []int{1, 2, 3}},
+		{"first four", "[1,2,3,4,5]", nil, []int{1, 2, 3, 4}},
+		{"hidden member", "[1,2,3,4,5]", map[int]bool{2: true}, []int{1, 3, 4}},
+		{"hidden fifth", "[1,2,3,4,5]", map[int]bool{5: true}, []int{1, 2, 3, 4}},
+	}
+	for _, c := range cases {
+		actors := "null"
+		for id := 1; id <= 5; id++ {
+			actors += "," + actor(id, c.hidden[id])
+		}
+		body := saveBody(mustJson(t, `{"actors":{"@":"Game_Actors","_data":{"@a":[`+actors+`]}},"party":{"@":"Game_Party","_actors":{"@a":`+c.members+`}}}`).(map[string]any))
+		se := &saveEntry{Id: 1, IndexJson: []byte(`{"title":"T","characters":[],"faces":[]}`)}
+		if err := updatePartyIndex(se, body, nil); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		var ie struct{ Characters [][]any }
+		if err := json.Unmarshal(se.IndexJson, &ie); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]int, 0)
+		for _, ch := range ie.Characters {
+			got = append(got, int(ch[1].(float64)))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestEquipSlot(t *testing.T) {
+	cases := []struct {
+		assign string
+		want   string // _equips after the assignment
+	}{
+		{"equip[0]=3", `[{"@":"Game_Item","_dataClass":"weapon","_itemId":3},{"@":"Game_Item","_dataClass":"armor","_itemId":1}]`},
+		{"equip[1]=0", `[{"@":"Game_Item","_dataClass":"weapon","_itemId":1},{"@":"Game_Item","_dataClass":"","_itemId":0}]`},
+		{"equip[3]=2", `[{"@":"Game_Item","_dataClass":"weapon","_itemId":1},{"@":"Game_Item","_dataClass":"armor","_itemId":1},` +
+			`{"@":"Game_Item","_dataClass":"","_itemId":0},{"@":"Game_Item","_dataClass":"armor","_itemId":2}]`},
+	}
+	for _, c := range cases {
+		actor := mustJson(t, `{"@":"Game_Actor","_equips":{"@a":[{"@":"Game_Item","_dataClass":"weapon","_itemId":1},{"@":"Game_Item","_dataClass":"armor","_itemId":1}]}}`).(map[string]any)
+		a, err := parseActorAssignment(c.assign, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", c.assign, err)
+		}
+		if err = a.apply(actor, nil); err != nil {
+			t.Fatalf("%s: %v", c.assign, err)
+		}
+		if got := jsonExArray(actor["_equips"]); !jsonEqual(got, mustJson(t, c.want)) {
+			t.Errorf("%s: got %s, want %s", c.assign, jsonString(got), c.want)
+		}
+	}
+}
+
+// write a save directory or an archive with entries of the IDs for tests.
+// the body of an entry has the ID as "id", and the index has the ID as the timestamp
+func writeTestSave(t *testing.T, path string, ids []int, protected ...int) {
+	t.Helper()
+	save := make([]*saveEntry, 0, len(ids))
+	for _, id := range ids {
+		se := &saveEntry{Id: id, IndexJson: []byte(fmt.Sprintf(`{"title":"T","timestamp":%d}`, id))}
+		if err := se.setBody(saveBody{"id": jsonNumber(id)}); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range protected {
+			se.Protected = se.Protected || p == id
+		}
+		save = append(save, se)
+	}
+	ss, err := NewSaveFileSelector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.readSaveAtPath(true, true) // detect the save type as commands do
+	if err = ss.writeSaveToPath(save, false, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read a save written by writeTestSave, as a map of an entry ID to the original ID in the body
+func readTestSave(t *testing.T, path string) map[int]int {
+	t.Helper()
+	ss, err := NewSaveFileSelector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	save, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[int]int)
+	for _, se := range save {
+		body, err := se.body()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[se.Id], _ = jsonInt(body["id"])
+	}
+	return ids
+}
+
+// set the config for commands run in tests, and restore it after the test
+func testConfig(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.verbose, cfg.onConflict, cfg.noSlotLimit = false, conflictOverwrite, true
+}
+
+func TestIdPairing(t *testing.T) {
+	testConfig(t)
+	cases := []struct {
+		cmd       string
+		src, dest string // selectors; "=>" in src for an ID mapping within the source
+		srcIds    []int
+		destIds   []int
+		want      map[int]int // entries of the destination after the command
+		wantSrc   map[int]int // entries of the source after mv
+	}{
+		{"cp", "@5,1,3", "@1-3", []int{1, 3, 5}, nil,
+			map[int]int{1: 5, 2: 1, 3: 3}, nil},
+		{"cp", "@5,2,3", "@1-3", []int{1, 3, 5}, nil,
+			map[int]int{1: 5, 3: 3}, nil},
+		{"cp", "@2,9,3", "@7-", []int{2, 3}, []int{8},
+			map[int]int{7: 2, 8: 8, 9: 3}, nil},
+		{"cp", "@2-", "@7-", []int{2, 4}, nil,
+			map[int]int{7: 2, 8: 4}, nil},
+		{"mv", "@1-5=>11-15", "", []int{1, 2, 4, 5}, nil,
+			nil, map[int]int{11: 1, 12: 2, 14: 4, 15: 5}},
+		{"mv", "@1,7,2=>11,12,13", "", []int{1, 2}, nil,
+			nil, map[int]int{11: 1, 13: 2}},
+		{"mv", "@3,1,2", "@1-3", []int{1, 2}, nil,
+			map[int]int{2: 1, 3: 2}, map[int]int{}},
+	}
+	for i, c := range cases {
+		dir := t.TempDir()
+		srcFile, destFile := filepath.Join(dir, "src.rpgarch"), filepath.Join(dir, "dest.rpgarch")
+		writeTestSave(t, srcFile, c.srcIds)
+		if c.destIds != nil {
+			writeTestSave(t, destFile, c.destIds)
+		}
+		src, dest := srcFile+c.src, destFile+c.dest
+		if s, d, ok := splitIdMapping(src); ok {
+			src, dest = s, d
+		}
+		srcSS, err := NewSaveFileSelector(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		destSS, err := NewSaveFileSelector(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.cmd == "cp" {
+			err = cmdCp([]*saveFileSelector{srcSS}, destSS)
+		} else {
+			err = cmdMv([]*saveFileSelector{srcSS}, destSS)
+		}
+		if err != nil {
+			t.Fatalf("#%d %s %s %s: %v", i, c.cmd, c.src, c.dest, err)
+		}
+		if c.want != nil {
+			if got := readTestSave(t, destFile); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("#%d %s %s %s: got %v, want %v", i, c.cmd, c.src, c.dest, got, c.want)
+			}
+		}
+		if c.wantSrc != nil {
+			if got := readTestSave(t, srcFile); !reflect.DeepEqual(got, c.wantSrc) {
+				t.Errorf("#%d %s %s %s: source %v, want %v", i, c.cmd, c.src, c.dest, got, c.wantSrc)
+			}
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	testConfig(t)
+	cases := []struct {
+		path      string // "save/" for a save directory
+		ids       []int
+		protected []int
+		start     string
+		want      map[int]int
+		err       error
+	}{
+		{"a.rpgarch", []int{2, 5, 9}, nil, "", map[int]int{1: 2, 2: 5, 3: 9}, nil},
+		{"a.rpgarch", []int{2, 5, 9}, nil, "3", map[int]int{3: 2, 4: 5, 5: 9}, nil},
+		{"a.rpgarch", []int{1, 2, 3}, nil, "", map[int]int{1: 1, 2: 2, 3: 3}, nil},
+		{"save/", []int{3, 7}, nil, "", map[int]int{1: 3, 2: 7}, nil},
+		{"save/", []int{3, 7}, nil, "6", map[int]int{6: 3, 7: 7}, nil},
+		{"save/", []int{1, 7}, []int{1}, "", map[int]int{1: 1, 2: 7}, nil},
+		{"save/", []int{3, 7}, []int{7}, "", nil, ErrProtected},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		path := filepath.Join(dir, c.path)
+		if strings.HasSuffix(c.path, "/") {
+			os.Mkdir(path, 0755)
+			path += "/"
+		}
+		writeTestSave(t, path, c.ids, c.protected...)
+		ss, err := NewSaveFileSelector(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cmdCompact(ss, c.start)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s %v from %q: got error %v, want %v", c.path, c.ids, c.start, err, c.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := readTestSave(t, path); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %v from %q: got %v, want %v", c.path, c.ids, c.start, got, c.want)
+		}
+		if strings.HasSuffix(c.path, "/") {
+			// no savefiles left at the old IDs
+			for _, id := range c.ids {
+				if _, ok := c.want[id]; ok {
+					continue
+				}
+				if _, err := os.Stat(rpgMvSaveFilename(path, id)); err == nil {
+					t.Errorf("%s %v from %q: file%d.rpgsave is left", c.path, c.ids, c.start, id)
+				}
+			}
+		}
+	}
+}
+
+func TestSwap(t *testing.T) {
+	testConfig(t)
+	cases := []struct {
+		name         string
+		a, b         string // selectors in the test directory; "save/" is a save directory
+		unprotect    bool
+		wantA, wantB map[int]int
+		err          error
+	}{
+		{"in a directory", "save/@2", "save/@3", false,
+			map[int]int{1: 1, 2: 3, 3: 2}, nil, nil},
+		{"directory and archive", "save/@2", "b.rpgarch@5", false,
+			map[int]int{1: 1, 2: 5, 3: 3}, map[int]int{2: 2, 5: 2, 6: 6}, nil},
+		{"to an empty slot", "save/@4", "b.rpgarch@6", false,
+			map[int]int{1: 1, 2: 2, 3: 3, 4: 6}, map[int]int{2: 2, 5: 5}, nil},
+		{"protected in a directory", "save/@1", "b.rpgarch@5", false,
+			nil, nil, ErrProtected},
+		{"protected in an archive", "save/@3", "b.rpgarch@2", false,
+			nil, nil, ErrProtected},
+		{"unprotected", "save/@1", "b.rpgarch@2", true,
+			map[int]int{1: 2, 2: 2, 3: 3}, map[int]int{2: 1, 5: 5, 6: 6}, nil},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		os.Mkdir(filepath.Join(dir, "save"), 0755)
+		writeTestSave(t, filepath.Join(dir, "save")+"/", []int{1, 2, 3}, 1)
+		writeTestSave(t, filepath.Join(dir, "b.rpgarch"), []int{2, 5, 6}, 2)
+		cfg.unprotect = c.unprotect
+
+		a, err := NewSaveFileSelector(filepath.Join(dir, c.a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewSaveFileSelector(filepath.Join(dir, c.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cmdSwap(a, b)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got error %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if err != nil {
+			// nothing is changed
+			c.wantA, c.wantB = map[int]int{1: 1, 2: 2, 3: 3}, map[int]int{2: 2, 5: 5, 6: 6}
+		}
+		if got := readTestSave(t, filepath.Join(dir, "save")+"/"); !reflect.DeepEqual(got, c.wantA) {
+			t.Errorf("%s: save directory %v, want %v", c.name, got, c.wantA)
+		}
+		if c.wantB == nil {
+			continue
+		}
+		if got := readTestSave(t, filepath.Join(dir, "b.rpgarch")); !reflect.DeepEqual(got, c.wantB) {
+			t.Errorf("%s: archive %v, want %v", c.name, got, c.wantB)
+		}
+	}
+}
+
+func TestProtectedCommands(t *testing.T) {
+	testConfig(t)
+	type selectors func(paths ...string) []*saveFileSelector
+	cases := []struct {
+		name         string
+		run          func(sel selectors) error
+		unprotect    bool
+		wantA, wantB map[int]int // nil if not changed
+		err          error
+	}{
+		{"rm", func(sel selectors) error { return cmdRm(sel("save/@2")[0]) }, false,
+			nil, nil, ErrProtected},
+		{"rm a range", func(sel selectors) error { return cmdRm(sel("save/@1-3")[0]) }, false,
+			nil, nil, ErrProtected},
+		{"rm unprotected", func(sel selectors) error { return cmdRm(sel("save/@2")[0]) }, true,
+			map[int]int{1: 1, 3: 3, 4: 4}, nil, nil},
+		{"mv from", func(sel selectors) error { return cmdMv(sel("save/@2"), sel("b.rpgarch@5")[0]) }, false,
+			nil, nil, ErrProtected},
+		{"mv over", func(sel selectors) error { return cmdMv(sel("save/@1"), sel("save/@2")[0]) }, false,
+			nil, nil, ErrProtected},
+		{"cp over", func(sel selectors) error { return cmdCp(sel("save/@1"), sel("b.rpgarch@2")[0]) }, false,
+			nil, nil, ErrProtected},
+		{"cp to a free slot", func(sel selectors) error { return cmdCp(sel("save/@1"), sel("b.rpgarch@3")[0]) }, false,
+			nil, map[int]int{1: 1, 2: 2, 3: 1}, nil},
+		{"sort renumbering", func(sel selectors) error { return cmdSort(sel("save/")[0]) }, false,
+			nil, nil, ErrProtected},
+		{"sort others", func(sel selectors) error { return cmdSort(sel("save/@3-4")[0]) }, false,
+			map[int]int{1: 1, 2: 2, 3: 4, 4: 3}, nil, nil},
+		{"compact", func(sel selectors) error { return cmdCompact(sel("save/")[0], "2") }, false,
+			nil, nil, ErrProtected},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		save := filepath.Join(dir, "save") + "/"
+		os.Mkdir(save, 0755)
+		writeTestSave(t, save, []int{1, 2, 3, 4}, 2)
+		writeTestSave(t, filepath.Join(dir, "b.rpgarch"), []int{1, 2}, 2)
+		cfg.unprotect = c.unprotect
+		cfg.orderBy, cfg.reverse = "timestamp", true
+
+		sel := func(paths ...string) []*saveFileSelector {
+			list := make([]*saveFileSelector, 0, len(paths))
+			for _, p := range paths {
+				ss, err := NewSaveFileSelector(filepath.Join(dir, p))
+				if err != nil {
+					t.Fatal(err)
+				}
+				list = append(list, ss)
+			}
+			return list
+		}
+		err := c.run(sel)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%s: got error %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if c.wantA == nil {
+			c.wantA = map[int]int{1: 1, 2: 2, 3: 3, 4: 4}
+		}
+		if c.wantB == nil {
+			c.wantB = map[int]int{1: 1, 2: 2}
+		}
+		if got := readTestSave(t, save); !reflect.DeepEqual(got, c.wantA) {
+			t.Errorf("%s: save directory %v, want %v", c.name, got, c.wantA)
+		}
+		if got := readTestSave(t, filepath.Join(dir, "b.rpgarch")); !reflect.DeepEqual(got, c.wantB) {
+			t.Errorf("%s: archive %v, want %v", c.name, got, c.wantB)
+		}
+	}
+}
+
+func TestWatchState(t *testing.T) {
+	now := time.Now()
+	s1, s2 := fileState{10, now}, fileState{20, now.Add(time.Second)}
+	polls := []struct {
+		states map[int]fileState
+		copied bool // the ready savefiles are copied
+		want   []int
+	}{
+		{map[int]fileState{1: s1}, true, []int{}}, // written
+		{map[int]fileState{1: s1}, true, []int{1}},
+		{map[int]fileState{1: s1}, true, []int{}}, // already copied
+		{map[int]fileState{1: s2}, true, []int{}}, // being written
+		{map[int]fileState{1: s2, 2: s1}, false, []int{1}},
+		{map[int]fileState{1: s2, 2: s1}, true, []int{1, 2}}, // retried after a failure
+		{map[int]fileState{1: s2, 2: s1}, true, []int{}},
+		{map[int]fileState{}, true, []int{}}, // removed
+		{map[int]fileState{1: s2}, true, []int{}},
+		{map[int]fileState{1: s2}, true, []int{1}},
+	}
+	w := newWatchState()
+	for i, p := range polls {
+		got := w.update(p.states)
+		if !reflect.DeepEqual(got, p.want) {
+			t.Errorf("poll %d: got %v, want %v", i, got, p.want)
+		}
+		if p.copied {
+			w.markCopied(got)
+		}
+	}
+}
+
+func TestSnapshotSaves(t *testing.T) {
+	testConfig(t)
+	dir := t.TempDir()
+	save := filepath.Join(dir, "save") + "/"
+	os.Mkdir(save, 0755)
+	archive := filepath.Join(dir, "snap.rpgarch")
+	writeTestSave(t, save, []int{1, 2})
+
+	steps := []struct {
+		ids      []int // saves in the directory
+		snapshot []int // IDs to snapshot
+		done     []int
+		want     map[int]int
+	}{
+		{[]int{1, 2}, []int{1, 2, 3}, []int{1, 2}, map[int]int{1: 1, 2: 2}}, // 3 is not in the index yet
+		{[]int{1, 2}, []int{1, 2}, []int{1, 2}, map[int]int{1: 1, 2: 2}},    // bodies already in the archive
+		{[]int{1, 2, 3}, []int{2, 3}, []int{2, 3}, map[int]int{1: 1, 2: 2, 3: 3}},
+	}
+	for i, s := range steps {
+		writeTestSave(t, save, s.ids)
+		src, err := NewSaveFileSelector(save)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest, err := NewSaveFileSelector(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done, err := snapshotSaves(src, dest, s.snapshot)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(done, s.done) {
+			t.Errorf("step %d: done %v, want %v", i, done, s.done)
+		}
+		if got := readTestSave(t, archive); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("step %d: archive %v, want %v", i, got, s.want)
+		}
+	}
+}
+
+func TestSortEntriesBy(t *testing.T) {
+	testConfig(t)
+	index := map[int]string{
+		1: `{"timestamp":300,"playtime":"00:10:00","mapname":"Town"}`,
+		2: `{"timestamp":100,"playtime":"00:10:00","mapname":"cave"}`,
+		3: `{"timestamp":300,"playtime":"00:05:00","mapname":"town"}`,
+		5: `{"timestamp":200,"playtime":"01:00:00","mapname":"Castle"}`,
+	}
+	cases := []struct {
+		by      string
+		reverse bool
+		want    []int
+	}{
+		{"timestamp", false, []int{2, 5, 1, 3, 4}},
+		{"timestamp", true, []int{1, 3, 5, 2, 4}},
+		{"playtime", false, []int{3, 1, 2, 5, 4}},
+		{"playtime", true, []int{5, 1, 2, 3, 4}},
+		{"map", false, []int{5, 2, 1, 3, 4}},
+		{"map", true, []int{1, 3, 2, 5, 4}},
+		{"id", false, []int{1, 2, 3, 4, 5}},
+		{"id", true, []int{5, 4, 3, 2, 1}},
+	}
+	for _, c := range cases {
+		entries := make([]*saveEntry, 0)
+		for _, id := range []int{3, 1, 5, 4, 2} {
+			se := &saveEntry{Id: id}
+			if ie, ok := index[id]; ok {
+				se.IndexJson = []byte(ie)
+			}
+			entries = append(entries, se)
+		}
+		cfg.reverse = c.reverse
+		if err := sortEntriesBy(entries, c.by); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]int, len(entries))
+		for i, se := range entries {
+			got[i] = se.Id
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("-by=%s -r=%v: got %v, want %v", c.by, c.reverse, got, c.want)
+		}
+	}
+	if err := sortEntriesBy(nil, "size"); err == nil {
+		t.Errorf("-by=size: no error")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -24,6 +25,8 @@ const (
 	idSeparator = '@' // separator between filename and id
 
 	idNotOpenEnded = math.MaxInt // the id that represents not-a-open-range
+
+	idMappingArrow = "=>" // separator between source IDs and destination IDs
 )
 
 var (
@@ -88,7 +91,13 @@ type saveEntry struct {
 	IndexJson json.RawMessage // decoded raw index, extracted from "global.rpgsave"
 	SaveData  string          // contents of "file%d.rpgsave"
 
-	Comment string // comment
+	Comment string   // comment
+	Tags    []string // tags
+
+	Origin  string // the original location of a deleted entry in the trash
+	Deleted int64  // the time an entry is moved to the trash, in unix milliseconds
+
+	Protected bool // refuse to overwrite or remove the entry
 }
 
 func (se *saveEntry) indexEntry() (indexEntry *rpgMvSaveIndexEntry, err error) {
@@ -122,19 +131,8 @@ func (ss *saveFileSelector) readRpgMvSaveIndex() (save []*saveEntry, err error)
 	if err != nil {
 		return
 	}
-	ss.ResetId()
-	currentId, ok := ss.NextId()
 	for i, d := range sIndex {
-		if d == nil {
-			continue
-		}
-		for currentId < i && ok {
-			currentId, ok = ss.NextId()
-		}
-		if !ok {
-			break
-		}
-		if i < currentId {
+		if d == nil || !ss.selects(i) {
 			continue
 		}
 		var se *rpgMvSaveIndexEntry
@@ -175,7 +173,7 @@ func (ss *saveFileSelector) readRpgMvSaveAll() (save []*saveEntry, err error) {
 }
 
 // write savefile index to global.rpgsave
-func writeRpgMvSaveIndex(save []*saveEntry, dirpath string) (err error) {
+func writeRpgMvSaveIndex(t *fileTransaction, save []*saveEntry, dirpath string) (err error) {
 	sIndex := make([]json.RawMessage, 0)
 	for _, e := range save {
 		data := e.IndexJson
@@ -193,11 +191,15 @@ func writeRpgMvSaveIndex(save []*saveEntry, dirpath string) (err error) {
 	}
 	indexFile := rpgMvIndexFilename(dirpath)
 	enc := lzstring.CompressToBase64(string(js))
-	return os.WriteFile(indexFile, []byte(enc), 0644)
+	err = t.writeFile(indexFile, []byte(enc), 0644)
+	if err == nil && verifyWrites(true) {
+		t.verifyWith(indexFile, func(data []byte) error { return verifyRpgMvIndex(data, js) })
+	}
+	return
 }
 
 // write individual savedata files to rpg maker mv save directory
-func writeRpgMvSave(dirpath string, save *saveEntry) (filename string, err error) {
+func writeRpgMvSave(t *fileTransaction, dirpath string, save *saveEntry) (filename string, err error) {
 	filename = rpgMvSaveFilename(dirpath, save.Id)
 	if save.SaveData == "" {
 		err = ErrNoData
@@ -212,21 +214,24 @@ func writeRpgMvSave(dirpath string, save *saveEntry) (filename string, err error
 			return
 		}
 	}
-	err = os.WriteFile(filename, []byte(save.SaveData), 0644)
+	err = t.writeFile(filename, []byte(save.SaveData), 0644)
+	if err == nil && verifyWrites(true) {
+		t.verifyWith(filename, func(data []byte) error {
+			if e := verifySaveBody(string(data), save.SaveData); e != nil {
+				return fmt.Errorf("cannot decode the save: %w", e)
+			}
+			return nil
+		})
+	}
 	return
 }
 
-// write index and savedata files to rpg maker mv save directory
-func writeRpgMvSaveAll(dirpath string, save []*saveEntry) (err error) {
-	// write index
-	err = writeRpgMvSaveIndex(save, dirpath)
-	if err != nil {
-		return
-	}
-
+// write index and savedata files to rpg maker mv save directory.
+// savedata files are staged before the index, so the index is replaced last on commit
+func writeRpgMvSaveAll(t *fileTransaction, dirpath string, save []*saveEntry) (err error) {
 	// write each file
 	for _, f := range save {
-		_, e := writeRpgMvSave(dirpath, f)
+		_, e := writeRpgMvSave(t, dirpath, f)
 		switch e {
 		case ErrNoData:
 		case ErrNotChanged:
@@ -239,11 +244,12 @@ func writeRpgMvSaveAll(dirpath string, save []*saveEntry) (err error) {
 		//f.filename = fname // store last save filename
 	}
 
-	return
+	// write index
+	return writeRpgMvSaveIndex(t, save, dirpath)
 }
 
 // remove individual savefiles that are NOT contained in the save entries
-func removeUnusedRpgMvSave(dirpath string, save []*saveEntry) (err error) {
+func removeUnusedRpgMvSave(t *fileTransaction, dirpath string, save []*saveEntry) (err error) {
 	// list indexes
 	idmap := make(map[int]bool)
 	for _, s := range save {
@@ -265,10 +271,12 @@ func removeUnusedRpgMvSave(dirpath string, save []*saveEntry) (err error) {
 		}
 		id, _ := strconv.Atoi(m[1])
 		if !idmap[id] {
-			err = os.Remove(f.Name())
-			if err != nil {
-				return
+			filename := filepath.Join(dirpath, f.Name())
+			if data, e := os.ReadFile(filename); e == nil {
+				// keep the contents in the trash, unless it is written to another place
+				t.moveToTrash(filepath.Clean(dirpath), filename, &saveEntry{Id: id, SaveData: string(data)}, false)
 			}
+			t.removeFile(filename)
 		}
 	}
 
@@ -285,7 +293,13 @@ type archEntry struct {
 	SaveData string          `json:"saveData,omitempty"` // contents of "file%d.rpgsave"
 	SaveJson json.RawMessage `json:"saveJson,omitempty"` // decoded save data
 
-	Comment string `json:"comment,omitempty"` // comment
+	Comment string   `json:"comment,omitempty"` // comment
+	Tags    []string `json:"tags,omitempty"`    // tags
+
+	Origin  string `json:"origin,omitempty"`  // the original location of a deleted entry in the trash
+	Deleted int64  `json:"deleted,omitempty"` // the time an entry is moved to the trash, in unix milliseconds
+
+	Protected bool `json:"protected,omitempty"` // refuse to overwrite or remove the entry
 }
 
 // read rpgarch file
@@ -304,51 +318,57 @@ func (ss *saveFileSelector) readRpgArch() (save []*saveEntry, err error) {
 	sv := make([]*saveEntry, 0)
 
 	// normalize index
-	ss.ResetId()
-	currentId, ok := ss.NextId()
 	for _, en := range arch {
-		for currentId < en.Id && ok {
-			currentId, ok = ss.NextId()
-		}
-		if !ok {
-			break
-		}
-		if en.Id < currentId {
+		if !ss.selects(en.Id) {
 			continue
 		}
+		sv = append(sv, en.saveEntry())
+	}
+	return sv, nil
+}
 
-		sve := &saveEntry{
-			Id:      en.Id,
-			Comment: en.Comment,
-		}
-		if en.IndexJson != nil {
-			// index in raw json
-			sve.IndexJson = en.IndexJson
-		} else if en.Index != "" {
-			// index in compressed lzstring
-			jstr, e := lzstring.DecompressBase64(en.Index)
-			if e == nil && jstr != "" {
-				sve.IndexJson = []byte(jstr)
-			}
-		}
-		if en.SaveData != "" {
-			// savedata in compressed lzstring
-			sve.SaveData = en.SaveData
-		} else if en.SaveJson != nil {
-			// compress raw json to lzstring
-			sve.SaveData = lzstring.CompressToBase64(string(en.SaveJson))
+// convert an archive entry to a save entry
+func (en *archEntry) saveEntry() *saveEntry {
+	sve := &saveEntry{
+		Id:      en.Id,
+		Comment: en.Comment,
+		Tags:    en.Tags,
+		Origin:  en.Origin,
+		Deleted: en.Deleted,
+
+		Protected: en.Protected,
+	}
+	if en.IndexJson != nil {
+		// index in raw json
+		sve.IndexJson = en.IndexJson
+	} else if en.Index != "" {
+		// index in compressed lzstring
+		jstr, e := lzstring.DecompressBase64(en.Index)
+		if e == nil && jstr != "" {
+			sve.IndexJson = []byte(jstr)
 		}
-		sv = append(sv, sve)
 	}
-	return sv, nil
+	if en.SaveData != "" {
+		// savedata in compressed lzstring
+		sve.SaveData = en.SaveData
+	} else if en.SaveJson != nil {
+		// compress raw json to lzstring
+		sve.SaveData = lzstring.CompressToBase64(string(en.SaveJson))
+	}
+	return sve
 }
 
-func writeRpgArch(filename string, save []*saveEntry, rawJson, pretty bool) (err error) {
+func writeRpgArch(t *fileTransaction, filename string, save []*saveEntry, rawJson, pretty bool) (err error) {
 	arch := make([]*archEntry, len(save))
 	for i, se := range save {
 		ae := &archEntry{
 			Id:      se.Id,
 			Comment: se.Comment,
+			Tags:    se.Tags,
+			Origin:  se.Origin,
+			Deleted: se.Deleted,
+
+			Protected: se.Protected,
 		}
 		if rawJson {
 			ae.IndexJson = se.IndexJson
@@ -372,7 +392,11 @@ func writeRpgArch(filename string, save []*saveEntry, rawJson, pretty bool) (err
 		return
 	}
 
-	return os.WriteFile(filename, data, 0644)
+	err = t.writeFile(filename, data, 0644)
+	if err == nil && verifyWrites(false) {
+		t.verifyWith(filename, func(data []byte) error { return verifyRpgArch(data, save) })
+	}
+	return
 }
 
 var (
@@ -389,27 +413,46 @@ type saveFileSelector struct {
 	IdList    []int // list of individual IDs
 	OpenStart int   // the first id of open-ended id list. if idNotOpenEnded, then there is no open-ended id list
 
+	Query *selectorQuery // symbolic selector such as @tag:TAG or @latest. resolved to IdList and OpenStart when the save is read
+
+	AllIds bool // neither ID nor query is given. the ID list is the same as @1-
+
 	currentIdList []int // internal vars for NextId()
 	currentOpen   int
 }
 
 // init the savefile selector with filepath and id string
 func NewSaveFileSelector(pathAndId string) (*saveFileSelector, error) {
-	path, id, openStart, err := parsePathIndex(pathAndId)
+	path, q, err := parsePathQuery(pathAndId)
 	if err != nil {
 		return nil, err
 	}
+	id, openStart, allIds := []int(nil), idNotOpenEnded, false
+	if q == nil {
+		m := idMatch.FindStringSubmatch(path)
+		path, id, openStart, err = parsePathIndex(path)
+		if err != nil {
+			return nil, err
+		}
+		allIds = (m == nil || m[2] == "") && id == nil
+	} else if path == "" {
+		// the current directory
+		path = "." + string(os.PathSeparator)
+	}
 
-	return &saveFileSelector{
+	ss := &saveFileSelector{
 		Path:           path,
 		NormalizedPath: path,
 
 		IdList:    id,
 		OpenStart: openStart,
+		Query:     q,
+		AllIds:    allIds,
 
 		currentIdList: id,
 		currentOpen:   openStart,
-	}, nil
+	}
+	return ss, nil
 }
 
 // make filepath with an ID to be displayed
@@ -445,10 +488,94 @@ func (ss *saveFileSelector) ResetId() {
 	ss.currentIdList, ss.currentOpen = ss.IdList, ss.OpenStart
 }
 
+// check whether the id is selected by the ID list.
+func (ss *saveFileSelector) selects(id int) bool {
+	if id >= ss.OpenStart {
+		return true
+	}
+	for _, i := range ss.IdList {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// check whether the ID list is in increasing order.
+func (ss *saveFileSelector) isIncreasing() bool {
+	for i := 1; i < len(ss.IdList); i++ {
+		if ss.IdList[i] <= ss.IdList[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// sort entries in the order written in the ID list. entries in the open-ended range follow in increasing order.
+func (ss *saveFileSelector) orderEntries(entries []*saveEntry) []*saveEntry {
+	pos := make(map[int]int)
+	for i, id := range ss.IdList {
+		pos[id] = i
+	}
+	order := func(id int) int {
+		if p, ok := pos[id]; ok {
+			return p
+		}
+		return len(ss.IdList) + id
+	}
+	sorted := make([]*saveEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool { return order(sorted[i].Id) < order(sorted[j].Id) })
+	return sorted
+}
+
+// sort entries in the order written in the ID list, with nil for a listed ID without an entry,
+// so that the entries are paired with the destination IDs by the position. entries in the open-ended range follow in increasing order.
+func (ss *saveFileSelector) pairEntries(entries []*saveEntry) []*saveEntry {
+	m := mkEntryMap(entries)
+	paired := make([]*saveEntry, 0, len(entries))
+	for _, id := range ss.IdList {
+		paired = append(paired, m[id])
+		delete(m, id)
+	}
+	for _, se := range ss.orderEntries(entries) {
+		if _, ok := m[se.Id]; ok {
+			paired = append(paired, se)
+		}
+	}
+	return paired
+}
+
+// check whether the id is written in the ID list, not in the open-ended range
+func (ss *saveFileSelector) isListed(id int) bool {
+	for _, i := range ss.IdList {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// split a path with an ID mapping "FILENAME@SRCID,...=>DESTID,..." to the source and the destination selector strings.
+// ok is false if the path has no mapping.
+func splitIdMapping(pathAndId string) (src, dest string, ok bool) {
+	i := strings.Index(pathAndId, idMappingArrow)
+	if i < 0 {
+		return pathAndId, "", false
+	}
+	src, destIds := pathAndId[:i], pathAndId[i+len(idMappingArrow):]
+	sep := strings.LastIndexAny(src, "#@")
+	if sep < 0 {
+		return pathAndId, "", false
+	}
+	return src, src[:sep+1] + destIds, true
+}
+
 // parse filename with ID numbers separated with a idSeparator mark.
-// ID is comma-separated, hyphen-connected increasing numbers.
+// ID is comma-separated, hyphen-connected numbers. The IDs are kept in the written order; a range may be decreasing.
 // openStartId contains the last id entry when it ends with a hyphen. idNotOpenEnded if the list is not open-ended.
 // ex) "FILENAME@1,2,7,8-10,13,25-" -> id=[1,2,7,8,9,10,13], openStart=25
+// ex) "FILENAME@5,1,3-2" -> id=[5,1,3,2], openStart=idNotOpenEnded
 func parsePathIndex(namepath string) (path string, id []int, openStartId int, err error) {
 
 	idStr := ""
@@ -471,7 +598,9 @@ func parsePathIndex(namepath string) (path string, id []int, openStartId int, er
 			if fdir == "" {
 				fdir = "."
 			}
-			fdir += string(os.PathSeparator)
+			if !os.IsPathSeparator(fdir[len(fdir)-1]) {
+				fdir += string(os.PathSeparator)
+			}
 			return fdir, []int{fid}, idNotOpenEnded, nil
 		}
 
@@ -482,7 +611,16 @@ func parsePathIndex(namepath string) (path string, id []int, openStartId int, er
 	// split IDstr with commas
 	idList := make([]int, 0)
 	a := strings.Split(idStr, ",")
-	last := -1
+	seen := make(map[int]bool)
+	addId := func(n int) error {
+		if seen[n] {
+			// duplicated id
+			return ErrInvalidId
+		}
+		seen[n] = true
+		idList = append(idList, n)
+		return nil
+	}
 	_openStartId := idNotOpenEnded
 	_endIsOpen := false
 	for _, s := range a {
@@ -499,10 +637,6 @@ func parsePathIndex(namepath string) (path string, id []int, openStartId int, er
 				if err != nil {
 					return
 				}
-				if a <= last {
-					err = ErrInvalidId
-					return
-				}
 			}
 			if m[2] == "" {
 				// open end
@@ -513,22 +647,34 @@ func parsePathIndex(namepath string) (path string, id []int, openStartId int, er
 			if err != nil {
 				return
 			}
-			for i := a; i <= b; i++ {
-				idList = append(idList, i)
+			step := 1
+			if a > b { // decreasing range
+				step = -1
+			}
+			for i := a; ; i += step {
+				if err = addId(i); err != nil {
+					return
+				}
+				if i == b {
+					break
+				}
 			}
-			last = b
 		} else { // single id
 			var n int
 			n, err = strconv.Atoi(s)
 			if err != nil {
 				return
 			}
-			if n <= last {
-				err = ErrInvalidId
+			if err = addId(n); err != nil {
 				return
 			}
-			idList = append(idList, n)
-			last = n
+		}
+	}
+	for _, n := range idList {
+		if n >= _openStartId {
+			// the id is also in the open-ended range
+			err = ErrInvalidId
+			return
 		}
 	}
 
@@ -589,6 +735,31 @@ func detectSaveType(inPath string) (path string, isRpgMvSave bool, err error) {
 // if allEntry is true, then ss.IdList and ss.OpenStart is ignored and all entries are loaded
 func (ss *saveFileSelector) readSaveAtPath(indexOnly bool, allEntry bool) (save []*saveEntry, err error) {
 
+	if ss.Query != nil { // resolve the query
+		// read all entries with a temporary selector
+		tmpss := *ss
+		tmpss.Query, tmpss.IdList, tmpss.OpenStart = nil, nil, 0
+		tmpss.ResetId()
+		save, err = tmpss.readSaveAtPath(indexOnly, false)
+		ss.NormalizedPath, ss.IsRpgMvSave = tmpss.NormalizedPath, tmpss.IsRpgMvSave
+
+		// replace the query with the resolved ID list.
+		// the query is resolved even if the save could not be read, as an empty save
+		ids, openStart, e := ss.Query.resolve(save, ss.IsRpgMvSave)
+		if e != nil {
+			return nil, fmt.Errorf("%s%c%s: %w", ss.Path, idSeparator, ss.Query, e)
+		}
+		ss.IdList, ss.OpenStart, ss.Query = ids, openStart, nil
+		ss.ResetId()
+		if err != nil {
+			return
+		}
+		if !allEntry {
+			save = ss.selectEntries(save)
+		}
+		return
+	}
+
 	if allEntry && (len(ss.IdList) > 0 || ss.OpenStart != idNotOpenEnded) { // read all entry
 		// make a temporary selector with "all" selector
 		tmpss := *ss
@@ -609,18 +780,33 @@ func (ss *saveFileSelector) readSaveAtPath(indexOnly bool, allEntry bool) (save
 	if rpgMvSave {
 		if indexOnly {
 			save, err = ss.readRpgMvSaveIndex()
-			return
 		} else {
 			save, err = ss.readRpgMvSaveAll()
-			return
 		}
+		if err == nil {
+			// protected slots are listed in a separate file
+			err = markProtected(path, save)
+		}
+		return
 	}
 	save, err = ss.readRpgArch()
 	return
 }
 
-// write the save to the path, autodetecting the save type
+// write the save to the path, autodetecting the save type.
+// the files are replaced all together, or left untouched if any of them fails
 func (ss *saveFileSelector) writeSaveToPath(save []*saveEntry, rawJson, pretty bool) (err error) {
+	t := newFileTransaction()
+	defer t.discard()
+	err = ss.stageSaveToPath(t, save, rawJson, pretty)
+	if err != nil {
+		return
+	}
+	return t.commit()
+}
+
+// stage writing the save to the path in a transaction, autodetecting the save type
+func (ss *saveFileSelector) stageSaveToPath(t *fileTransaction, save []*saveEntry, rawJson, pretty bool) (err error) {
 	path, rpgMvSave := ss.NormalizedPath, ss.IsRpgMvSave
 	if path == "" {
 		path, rpgMvSave, err = detectSaveType(ss.Path)
@@ -628,14 +814,29 @@ func (ss *saveFileSelector) writeSaveToPath(save []*saveEntry, rawJson, pretty b
 			return
 		}
 	}
+	t.keep(save)
+	if cfg.dryRun {
+		// show the resulting entries
+		fmt.Printf("dry run: resulting saves\n")
+		err = printSaveList(path, save)
+		if err != nil {
+			return
+		}
+	}
 	if rpgMvSave {
 		// write the savefiles as Rpg maker MV save directory
-		err = os.MkdirAll(path, 0644)
+		if !cfg.dryRun {
+			err = os.MkdirAll(path, 0755)
+			if err != nil {
+				return
+			}
+		}
+		err = writeRpgMvSaveAll(t, path, save)
 		if err != nil {
 			return
 		}
-		return writeRpgMvSaveAll(path, save)
+		return stageProtectedSlots(t, path, save)
 	}
 	// write the savefiles as a JSON archive
-	return writeRpgArch(path, save, rawJson, pretty)
+	return writeRpgArch(t, path, save, rawJson, pretty)
 }
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBattleMembers = 4  // Game_Party.maxBattleMembers(); number of characters shown in the load screen
+	defaultMaxLevel  = 99 // max level of an actor when the game data is not available
+)
+
+var (
+	actorAssignMatch = regexp.MustCompile(`^(\w+)(?:\[(\d+)\])?(\+=|-=|=)(.*)$`) // KEY[SLOT]=VALUE, KEY+=VALUE, KEY-=VALUE
+	equipValueMatch  = regexp.MustCompile(`^(?:(weapon|armor):)?(.+)$`)          // weapon:ID, armor:ID
+)
+
+// exp required to reach the level. same as Game_Actor.expForLevel()
+func (c *rpgClassData) expForLevel(level int) int {
+	if len(c.ExpParams) < 4 {
+		return 0
+	}
+	basis, extra, accA, accB := c.ExpParams[0], c.ExpParams[1], c.ExpParams[2], c.ExpParams[3]
+	lv := float64(level)
+	return int(math.Round(basis*math.Pow(lv-1, 0.9+accA/250)*lv*(lv+1)/(6+math.Pow(lv, 2)/50/accB) + (lv-1)*extra))
+}
+
+// the level reached with the exp, up to maxLevel. same as the level up loop of Game_Actor.changeExp()
+func (c *rpgClassData) levelForExp(exp, maxLevel int) int {
+	level := 1
+	for level < maxLevel && exp >= c.expForLevel(level+1) {
+		level++
+	}
+	return level
+}
+
+// get the actor object in the save body. returns nil if the actor is not initialized in the save.
+func (b saveBody) actor(id int) (actor map[string]any, err error) {
+	data, err := b.objectData("actors")
+	if err != nil {
+		return
+	}
+	a := jsonExArray(data)
+	if id <= 0 || id >= len(a) {
+		return nil, nil
+	}
+	return jsonExObject(a[id]), nil
+}
+
+// get IDs of the party members in the save body
+func (b saveBody) partyMembers() (members []int, err error) {
+	party, err := b.object("party")
+	if err != nil {
+		return
+	}
+	for _, v := range jsonExArray(party["_actors"]) {
+		if id, ok := jsonInt(v); ok {
+			members = append(members, id)
+		}
+	}
+	return
+}
+
+// set IDs of the party members in the save body
+func (b saveBody) setPartyMembers(members []int) (err error) {
+	party, err := b.object("party")
+	if err != nil {
+		return
+	}
+	a := make([]any, len(members))
+	for i, id := range members {
+		a[i] = jsonNumber(id)
+	}
+	jsonExSetArray(party, "_actors", a)
+	return
+}
+
+// regenerate "characters" and "faces" of the index entry from the party members, as DataManager.makeSavefileInfo() does
+func updatePartyIndex(se *saveEntry, b saveBody, gd *gameData) (err error) {
+	members, err := b.partyMembers()
+	if err != nil {
+		return
+	}
+	if len(members) > maxBattleMembers {
+		// Game_Party.battleMembers() takes the first members, then drops hidden ones
+		members = members[:maxBattleMembers]
+	}
+	chars, faces := make([]any, 0), make([]any, 0)
+	for _, id := range members {
+		var actor map[string]any
+		actor, err = b.actor(id)
+		if err != nil {
+			return
+		}
+		if actor != nil {
+			if actor["_hidden"] == true {
+				continue
+			}
+			chars = append(chars, []any{actor["_characterName"], actor["_characterIndex"]})
+			faces = append(faces, []any{actor["_faceName"], actor["_faceIndex"]})
+			continue
+		}
+		// the actor is not initialized in the save; use the initial values in the database
+		var ad *rpgActorData
+		ad, err = gd.actor(id)
+		if err != nil {
+			return fmt.Errorf("actor %d: %w", id, err)
+		}
+		chars = append(chars, []any{ad.CharacterName, jsonNumber(ad.CharacterIndex)})
+		faces = append(faces, []any{ad.FaceName, jsonNumber(ad.FaceIndex)})
+	}
+	return se.updateIndex(func(ie map[string]any) error {
+		ie["characters"], ie["faces"] = chars, faces
+		return nil
+	})
+}
+
+// parse a list of actor IDs or quoted names. each argument may be comma-separated.
+func parseActorList(args []string, gd *gameData) (ids []int, err error) {
+	for _, a := range args {
+		for _, s := range strings.Split(a, ",") {
+			if s == "" {
+				continue
+			}
+			var id int
+			id, err = resolveId(s, gd.dataNameList(gameDataActors))
+			if err != nil {
+				return
+			}
+			if id <= 0 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidId, s)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+// modify party members of savefiles.
+// op is "add", "remove" or "order"; with an empty op, the party members are listed.
+func cmdParty(ss *saveFileSelector, op string, actors []string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+
+	gd := openGameData(ss)
+	ids, err := parseActorList(actors, gd)
+	if err != nil {
+		return
+	}
+
+	if op == "" || op == "ls" {
+		// list party members
+		for _, se := range ss.selectEntries(entries) {
+			var body saveBody
+			body, err = se.body()
+			if err != nil {
+				return fmt.Errorf("%s: %w", ss.displayPath(se.Id), err)
+			}
+			var members []int
+			members, err = body.partyMembers()
+			if err != nil {
+				return fmt.Errorf("%s: %w", ss.displayPath(se.Id), err)
+			}
+			fmt.Printf("#%d\n", se.Id)
+			lines := make([]string, 0)
+			for _, id := range members {
+				name, level := "", ""
+				if actor, _ := body.actor(id); actor != nil {
+					name, _ = actor["_name"].(string)
+					if lv, ok := jsonInt(actor["_level"]); ok {
+						level = fmt.Sprintf("Lv%d", lv)
+					}
+				}
+				lines = append(lines, fmt.Sprintf("  %d\000%s\000%s", id, name, level))
+			}
+			printAlignedLines(lines, "\000")
+		}
+		return
+	}
+
+	if len(ids) == 0 {
+		return fmt.Errorf("please provide actor IDs or names")
+	}
+
+	count, err := editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+		body, err := se.body()
+		if err != nil {
+			return
+		}
+		members, err := body.partyMembers()
+		if err != nil {
+			return
+		}
+		contains := func(l []int, id int) bool {
+			for _, i := range l {
+				if i == id {
+					return true
+				}
+			}
+			return false
+		}
+
+		newMembers := make([]int, 0)
+		switch op {
+		case "add":
+			newMembers = append(newMembers, members...)
+			for _, id := range ids {
+				if !contains(newMembers, id) {
+					newMembers = append(newMembers, id)
+				}
+			}
+		case "remove", "rm":
+			for _, id := range members {
+				if !contains(ids, id) {
+					newMembers = append(newMembers, id)
+				}
+			}
+		case "order":
+			// listed members first, then the rest in the current order
+			for _, id := range ids {
+				if !contains(members, id) {
+					return false, fmt.Errorf("actor %d is not a party member", id)
+				}
+				if !contains(newMembers, id) {
+					newMembers = append(newMembers, id)
+				}
+			}
+			for _, id := range members {
+				if !contains(newMembers, id) {
+					newMembers = append(newMembers, id)
+				}
+			}
+		default:
+			return false, fmt.Errorf("unknown party operation: %s", op)
+		}
+
+		if cfg.verbose {
+			fmt.Printf("modifying %s: party %v -> %v\n", ss.displayPath(se.Id), members, newMembers)
+		}
+		err = body.setPartyMembers(newMembers)
+		if err != nil {
+			return
+		}
+		err = updatePartyIndex(se, body, gd)
+		if err != nil {
+			return
+		}
+		return true, se.setBody(body)
+	})
+	if err != nil {
+		return
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves modified\n", count)
+	}
+	return
+}
+
+// an assignment to an actor status
+type actorAssignment struct {
+	text string // the assignment string
+
+	key       string // "level", "exp", "hp", "mp", "class", "equip" or "skill"
+	op        string // "=", "+=" or "-="
+	slot      int    // equipment slot
+	value     int    // value or ID
+	dataClass string // "weapon" or "armor" for equipments
+}
+
+// parse an actor assignment such as `level=10`, `class="Mage"`, `equip[0]=weapon:3`, `skill+=5`.
+func parseActorAssignment(s string, gd *gameData) (a *actorAssignment, err error) {
+	m := actorAssignMatch.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid assignment: %s", s)
+	}
+	a = &actorAssignment{text: s, key: strings.ToLower(m[1]), op: m[3]}
+	slot, value := m[2], strings.TrimSpace(m[4])
+
+	if a.key == "skills" {
+		a.key = "skill"
+	}
+	if (a.key == "skill") == (a.op == "=") {
+		return nil, fmt.Errorf("invalid operator: %s", s)
+	}
+	if (a.key == "equip") != (slot != "") {
+		return nil, fmt.Errorf("invalid slot: %s", s)
+	}
+
+	switch a.key {
+	case "level", "exp", "hp", "mp":
+		a.value, err = strconv.Atoi(value)
+		if err == nil && (a.value < 0 || (a.key == "level" && a.value < 1)) {
+			err = fmt.Errorf("invalid value: %s", s)
+		}
+
+	case "class":
+		a.value, err = resolveId(value, gd.dataNameList(gameDataClasses))
+		if err == nil && gd != nil {
+			_, err = gd.class(a.value)
+		}
+
+	case "skill":
+		a.value, err = resolveId(value, gd.dataNameList(gameDataSkills))
+		if err == nil && gd != nil {
+			err = gd.hasData(gameDataSkills, a.value)
+		}
+
+	case "equip":
+		a.slot, _ = strconv.Atoi(slot)
+		e := equipValueMatch.FindStringSubmatch(value)
+		if e == nil {
+			return nil, fmt.Errorf("invalid equipment: %s", s)
+		}
+		a.dataClass = e[1]
+		if a.dataClass == "" {
+			// the first slot is for weapons by default
+			a.dataClass = "armor"
+			if a.slot == 0 {
+				a.dataClass = "weapon"
+			}
+		}
+		filename := gameDataArmors
+		if a.dataClass == "weapon" {
+			filename = gameDataWeapons
+		}
+		a.value, err = resolveId(e[2], gd.dataNameList(filename))
+		if err == nil && a.value != 0 && gd != nil {
+			err = gd.hasData(filename, a.value)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown actor status: %s", m[1])
+	}
+	return
+}
+
+// apply the assignment to an actor object.
+// exp and level are kept consistent if class data is available.
+func (a *actorAssignment) apply(actor map[string]any, gd *gameData) (err error) {
+	classId, _ := jsonInt(actor["_classId"])
+	expMap := jsonExObject(actor["_exp"])
+	if expMap == nil {
+		expMap = make(map[string]any)
+		actor["_exp"] = expMap
+	}
+	classKey := strconv.Itoa(classId)
+
+	// class data, if available
+	var class *rpgClassData
+	maxLevel := defaultMaxLevel
+	if gd != nil {
+		class, _ = gd.class(classId)
+		actorId, _ := jsonInt(actor["_actorId"])
+		if ad, e := gd.actor(actorId); e == nil && ad.MaxLevel > 0 {
+			maxLevel = ad.MaxLevel
+		}
+	}
+
+	switch a.key {
+	case "level":
+		level := a.value
+		if level > maxLevel {
+			level = maxLevel
+		}
+		actor["_level"] = jsonNumber(level)
+		if class != nil {
+			expMap[classKey] = jsonNumber(class.expForLevel(level))
+		}
+
+	case "exp":
+		expMap[classKey] = jsonNumber(a.value)
+		if class != nil {
+			actor["_level"] = jsonNumber(class.levelForExp(a.value, maxLevel))
+		}
+
+	case "hp":
+		actor["_hp"] = jsonNumber(a.value)
+	case "mp":
+		actor["_mp"] = jsonNumber(a.value)
+
+	case "class":
+		// keep the current exp, as Game_Actor.changeClass(classId, true).
+		// the level follows the exp curve of the new class if the class data is available
+		expMap[strconv.Itoa(a.value)] = expMap[classKey]
+		actor["_classId"] = jsonNumber(a.value)
+		if gd != nil {
+			if newClass, e := gd.class(a.value); e == nil {
+				exp, _ := jsonInt(expMap[classKey])
+				actor["_level"] = jsonNumber(newClass.levelForExp(exp, maxLevel))
+			}
+		}
+
+	case "equip":
+		equips := jsonExArray(actor["_equips"])
+		n := len(equips)
+		equips, err = growArray(equips, a.slot)
+		if err != nil {
+			return
+		}
+		for i := n; i < len(equips); i++ {
+			// Game_Actor.equips() expects a Game_Item in every slot
+			equips[i] = map[string]any{"@": "Game_Item", "_dataClass": "", "_itemId": jsonNumber(0)}
+		}
+		item := jsonExObject(equips[a.slot])
+		if item == nil {
+			item = map[string]any{"@": "Game_Item"}
+			equips[a.slot] = item
+		}
+		if a.value == 0 {
+			item["_dataClass"], item["_itemId"] = "", jsonNumber(0)
+		} else {
+			item["_dataClass"], item["_itemId"] = a.dataClass, jsonNumber(a.value)
+		}
+		jsonExSetArray(actor, "_equips", equips)
+
+	case "skill":
+		// skills are kept sorted, as Game_Actor.learnSkill()
+		skills := make([]int, 0)
+		for _, v := range jsonExArray(actor["_skills"]) {
+			if id, ok := jsonInt(v); ok && id != a.value {
+				skills = append(skills, id)
+			}
+		}
+		if a.op == "+=" {
+			skills = append(skills, a.value)
+			sort.Ints(skills)
+		}
+		l := make([]any, len(skills))
+		for i, id := range skills {
+			l[i] = jsonNumber(id)
+		}
+		jsonExSetArray(actor, "_skills", l)
+	}
+	return
+}
+
+// modify an actor's status in savefiles
+func cmdActor(ss *saveFileSelector, actorName string, assign []string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+
+	gd := openGameData(ss)
+	ids, err := parseActorList([]string{actorName}, gd)
+	if err != nil {
+		return
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("please provide an actor ID or name")
+	}
+	actorId := ids[0]
+
+	al := make([]*actorAssignment, len(assign))
+	for i, s := range assign {
+		al[i], err = parseActorAssignment(s, gd)
+		if err != nil {
+			return
+		}
+	}
+
+	count, err := editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+		body, err := se.body()
+		if err != nil {
+			return
+		}
+		actor, err := body.actor(actorId)
+		if err != nil {
+			return
+		}
+		if actor == nil {
+			return false, fmt.Errorf("actor %d is not found in the save", actorId)
+		}
+		if cfg.verbose {
+			fmt.Printf("modifying %s\n", ss.displayPath(se.Id))
+		}
+		for _, a := range al {
+			err = a.apply(actor, gd)
+			if err != nil {
+				return
+			}
+			if cfg.verbose {
+				fmt.Printf("  actor %d: %s\n", actorId, a.text)
+			}
+		}
+		return true, se.setBody(body)
+	})
+	if err != nil {
+		return
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves modified\n", count)
+	}
+	return
+}
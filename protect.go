@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	protectFileName = "protected.json" // protected slots of a save directory, in the hidden directory next to the saves
+)
+
+var (
+	ErrProtected = errors.New("the slot is protected")
+)
+
+// get the file listing the protected slots of a rpg maker mv save directory
+func protectPath(dir string) string {
+	return filepath.Join(dir, journalDirName, protectFileName)
+}
+
+// read the protected slots of a rpg maker mv save directory
+func readProtectedSlots(dir string) (ids []int, err error) {
+	data, err := os.ReadFile(protectPath(dir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	err = json.Unmarshal(data, &ids)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", protectPath(dir), err)
+	}
+	return
+}
+
+// mark the entries of a rpg maker mv save directory listed as protected
+func markProtected(dir string, save []*saveEntry) (err error) {
+	ids, err := readProtectedSlots(dir)
+	if err != nil {
+		return
+	}
+	protected := make(map[int]bool)
+	for _, id := range ids {
+		protected[id] = true
+	}
+	for _, se := range save {
+		se.Protected = protected[se.Id]
+	}
+	return
+}
+
+// stage writing the protected slots of a rpg maker mv save directory, from the entries
+func stageProtectedSlots(t *fileTransaction, dir string, save []*saveEntry) (err error) {
+	ids := make([]int, 0)
+	for _, se := range save {
+		if se.Protected {
+			ids = append(ids, se.Id)
+		}
+	}
+	sort.Ints(ids)
+	old, err := readProtectedSlots(dir)
+	if err != nil {
+		return
+	}
+	if fmt.Sprint(old) == fmt.Sprint(ids) {
+		// not changed
+		return
+	}
+	filename := protectPath(dir)
+	if len(ids) == 0 {
+		t.removeFile(filename)
+		return
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return
+	}
+	if !cfg.dryRun {
+		err = os.MkdirAll(filepath.Dir(filename), 0755)
+		if err != nil {
+			return
+		}
+	}
+	return t.writeFile(filename, data, 0644)
+}
+
+// refuse to overwrite or remove a protected entry, unless --unprotect is given
+func (ss *saveFileSelector) checkProtected(se *saveEntry, action string) error {
+	if se == nil || !se.Protected || cfg.unprotect {
+		return nil
+	}
+	return fmt.Errorf("%w: cannot %s %s. use --unprotect to %s it anyway", ErrProtected, action, ss.displayPath(se.Id), action)
+}
+
+// list, protect or unprotect entries
+func cmdProtect(ss *saveFileSelector, op string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	if op == "" {
+		// protect the given IDs, or list protected entries without IDs
+		op = "on"
+		if ss.AllIds {
+			op = "ls"
+		}
+	}
+
+	switch op {
+	case "ls":
+		ids := make([]string, 0)
+		for _, se := range ss.selectEntries(entries) {
+			if se.Protected {
+				ids = append(ids, fmt.Sprintf("#%d", se.Id))
+			}
+		}
+		if len(ids) > 0 {
+			fmt.Println(strings.Join(ids, " "))
+		} else if cfg.verbose {
+			fmt.Printf("no protected saves\n")
+		}
+		return
+
+	case "on", "off":
+		protect := op == "on"
+		count := 0
+		for _, se := range ss.selectEntries(entries) {
+			if se.Protected == protect {
+				continue
+			}
+			se.Protected = protect
+			if cfg.verbose {
+				if protect {
+					fmt.Printf("protecting %s\n", ss.displayPath(se.Id))
+				} else {
+					fmt.Printf("unprotecting %s\n", ss.displayPath(se.Id))
+				}
+			}
+			count++
+		}
+		if count == 0 {
+			if cfg.verbose {
+				fmt.Printf("no saves changed\n")
+			}
+			return
+		}
+		return ss.writeSaveToPath(entries, cfg.rawJson, cfg.prettyJson)
+	}
+	return fmt.Errorf("unknown protect operation: %s", op)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Selector queries are symbolic selectors written in place of IDs, such as "FILENAME@tag:boss".
+// A query is resolved to a list of IDs when the save is read.
+//
+//	@tag:TAG,TAG,...   entries having any of the tags
+//	@latest, @newest   the entry saved most recently
+//	@newest:N          N entries saved most recently
+//	@oldest, @oldest:N the entries saved earliest
+//	@since:DATE        entries saved at or after the date, i.e. 2026-10-01 or "2026-10-01 18:00"
+//	@map:PATTERN       entries whose map name matches the pattern, i.e. Castle*
+//	@                  (empty) open-ended IDs after the last entry; to append entries
+
+var (
+	queryMatch = regexp.MustCompile(`^(.*)[#@]([a-z]+)(?::([^#@]*))?$`) // FILENAME.EXT@keyword:argument
+	tagMatch   = regexp.MustCompile(`^[\w.-]+$`)                        // a tag
+)
+
+var (
+	ErrNoTag = errors.New("tags can be stored only in archive files")
+)
+
+// date formats accepted by @since
+var queryDateFormats = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+// a parsed selector query
+type selectorQuery struct {
+	Keyword string // "tag", "latest", "newest", "oldest", "since", "map" or "" for appending
+	Arg     string // argument after the colon
+}
+
+func (q *selectorQuery) String() string {
+	if q.Arg == "" {
+		return q.Keyword
+	}
+	return q.Keyword + ":" + q.Arg
+}
+
+// parse a query part of a path. returns nil if the path does not end with a query.
+func parsePathQuery(namepath string) (basePath string, q *selectorQuery, err error) {
+	if strings.HasSuffix(namepath, "@") || strings.HasSuffix(namepath, "#") {
+		// append after the last entry
+		return namepath[:len(namepath)-1], &selectorQuery{}, nil
+	}
+	m := queryMatch.FindStringSubmatch(namepath)
+	if m == nil {
+		return namepath, nil, nil
+	}
+	q = &selectorQuery{Keyword: m[2], Arg: m[3]}
+	switch q.Keyword {
+	case "tag":
+		_, err = parseTags(q.Arg)
+	case "latest":
+		q.Keyword = "newest"
+		fallthrough
+	case "newest", "oldest":
+		_, err = q.count()
+	case "since":
+		_, err = parseQueryDate(q.Arg)
+	case "map":
+		if q.Arg == "" {
+			err = fmt.Errorf("no map name given")
+		} else {
+			_, err = path.Match(q.Arg, "")
+		}
+	default:
+		// not a query; the whole string is a filename
+		return namepath, nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", namepath, err)
+	}
+	return m[1], q, nil
+}
+
+// number of entries for @newest and @oldest
+func (q *selectorQuery) count() (n int, err error) {
+	if q.Arg == "" {
+		return 1, nil
+	}
+	n, err = strconv.Atoi(q.Arg)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid count: %s", q.Arg)
+	}
+	return
+}
+
+// parse a date for @since, in local time
+func parseQueryDate(s string) (t time.Time, err error) {
+	for _, f := range queryDateFormats {
+		t, err = time.ParseInLocation(f, s, time.Local)
+		if err == nil {
+			return
+		}
+	}
+	return t, fmt.Errorf("invalid date: %s", s)
+}
+
+// parse comma-separated tags
+func parseTags(s string) (tags []string, err error) {
+	for _, t := range strings.Split(s, ",") {
+		if t == "" {
+			continue
+		}
+		if !tagMatch.MatchString(t) {
+			return nil, fmt.Errorf("invalid tag: %q", t)
+		}
+		tags = append(tags, t)
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags given")
+	}
+	return
+}
+
+// check whether the entry has the tag
+func (se *saveEntry) hasTag(tag string) bool {
+	for _, t := range se.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve the query to a list of increasing IDs and the start of open-ended IDs, with all entries of the save
+func (q *selectorQuery) resolve(entries []*saveEntry, isRpgMvSave bool) (ids []int, openStart int, err error) {
+	ids, openStart = make([]int, 0), idNotOpenEnded
+
+	// index entries of the save, ordered by timestamp
+	indexed := func() []*saveEntry {
+		l := make([]*saveEntry, 0)
+		for _, se := range entries {
+			if _, e := se.indexEntry(); e == nil {
+				l = append(l, se)
+			}
+		}
+		sort.SliceStable(l, func(i, j int) bool {
+			a, _ := l[i].indexEntry()
+			b, _ := l[j].indexEntry()
+			return a.Timestamp < b.Timestamp
+		})
+		return l
+	}
+
+	switch q.Keyword {
+	case "":
+		// IDs after the last entry
+		openStart = 1
+		for _, se := range entries {
+			if se.Id >= openStart {
+				openStart = se.Id + 1
+			}
+		}
+		return
+
+	case "newest", "oldest":
+		n, _ := q.count()
+		l := indexed()
+		if n > len(l) {
+			n = len(l)
+		}
+		if q.Keyword == "newest" {
+			l = l[len(l)-n:]
+		} else {
+			l = l[:n]
+		}
+		for _, se := range l {
+			ids = append(ids, se.Id)
+		}
+
+	case "since":
+		t, _ := parseQueryDate(q.Arg)
+		for _, se := range indexed() {
+			if ie, _ := se.indexEntry(); !ie.timestamp().Before(t) {
+				ids = append(ids, se.Id)
+			}
+		}
+
+	case "map":
+		pattern := strings.ToLower(q.Arg)
+		for _, se := range entries {
+			ie, e := se.indexEntry()
+			if e != nil {
+				continue
+			}
+			if ok, _ := path.Match(pattern, strings.ToLower(ie.MapName)); ok {
+				ids = append(ids, se.Id)
+			}
+		}
+
+	case "tag":
+		// entries having any of the tags
+		if isRpgMvSave {
+			return nil, idNotOpenEnded, ErrNoTag
+		}
+		tags, _ := parseTags(q.Arg)
+		for _, se := range entries {
+			for _, t := range tags {
+				if se.hasTag(t) {
+					ids = append(ids, se.Id)
+					break
+				}
+			}
+		}
+	}
+	sort.Ints(ids)
+	return
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	lzstring "github.com/mixcode/golib-lzstring"
+)
+
+// Decoded contents of a savefile body ("file%d.rpgsave").
+// The body is a JsonEx-encoded object; class names ("@"), object ids ("@c") and array wrappers ("@a") are kept as is.
+// Numbers are decoded as json.Number so that untouched values are written back without any change.
+// Members of objects are written back in the order of the original body; see jsonOrder.
+type saveBody map[string]any
+
+const (
+	maxArrayIndex = 10000 // the largest ID of switches and variables written to a new slot; the editor of rpg maker mv allows up to 5000
+)
+
+var (
+	ErrNoSaveObject = errors.New("save object not found")
+)
+
+// decode a generic json value, keeping numbers as json.Number
+func decodeJsonValue(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// encode a generic json value without escaping HTML characters
+func encodeJsonValue(v any) (data []byte, err error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(v)
+	if err != nil {
+		return
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// Order of the members of objects in a json text.
+// A decoded map loses the order, so it is read separately to write an edited value in the original order.
+type jsonOrder struct {
+	keys     []string              // members of an object in the order
+	children map[string]*jsonOrder // order of the members of an object. nil for an array
+	elems    []*jsonOrder          // order of the elements of an array
+}
+
+// read the order of the members of objects in a json text. returns nil if the text cannot be read
+func readJsonOrder(data []byte) *jsonOrder {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	o, err := readJsonOrderValue(dec)
+	if err != nil {
+		return nil
+	}
+	return o
+}
+
+// read the order of a json value from the decoder. returns nil for a scalar value
+func readJsonOrderValue(dec *json.Decoder) (o *jsonOrder, err error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return
+	}
+	d, ok := tok.(json.Delim)
+	if !ok {
+		return nil, nil
+	}
+	o = &jsonOrder{}
+	if d == '{' {
+		o.children = make(map[string]*jsonOrder)
+	}
+	for dec.More() {
+		if o.children == nil {
+			var c *jsonOrder
+			c, err = readJsonOrderValue(dec)
+			if err != nil {
+				return
+			}
+			o.elems = append(o.elems, c)
+			continue
+		}
+		tok, err = dec.Token()
+		if err != nil {
+			return
+		}
+		key, _ := tok.(string)
+		var c *jsonOrder
+		c, err = readJsonOrderValue(dec)
+		if err != nil {
+			return
+		}
+		if _, dup := o.children[key]; !dup {
+			o.keys = append(o.keys, key)
+		}
+		o.children[key] = c
+	}
+	_, err = dec.Token() // the closing delimiter
+	return
+}
+
+// encode a generic json value, writing the members of objects in the order.
+// members not in the order are written after the others, sorted by the name
+func encodeJsonOrdered(v any, o *jsonOrder) (data []byte, err error) {
+	var buf bytes.Buffer
+	err = writeJsonOrdered(&buf, v, o)
+	if err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+func writeJsonOrdered(buf *bytes.Buffer, v any, o *jsonOrder) (err error) {
+	switch t := v.(type) {
+	case map[string]any:
+		if o == nil || o.children == nil {
+			break
+		}
+		keys := make([]string, 0, len(t))
+		for _, k := range o.keys {
+			if _, ok := t[k]; ok {
+				keys = append(keys, k)
+			}
+		}
+		added := make([]string, 0)
+		for k := range t {
+			if _, ok := o.children[k]; !ok {
+				added = append(added, k)
+			}
+		}
+		sort.Strings(added)
+		keys = append(keys, added...)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			var js []byte
+			js, err = encodeJsonValue(k)
+			if err != nil {
+				return
+			}
+			buf.Write(js)
+			buf.WriteByte(':')
+			err = writeJsonOrdered(buf, t[k], o.children[k])
+			if err != nil {
+				return
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case []any:
+		if o == nil || o.children != nil {
+			break
+		}
+		buf.WriteByte('[')
+		for i, e := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			var eo *jsonOrder
+			if i < len(o.elems) {
+				eo = o.elems[i]
+			}
+			err = writeJsonOrdered(buf, e, eo)
+			if err != nil {
+				return
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+	js, err := encodeJsonValue(v)
+	if err != nil {
+		return
+	}
+	buf.Write(js)
+	return nil
+}
+
+// decode lzstring-compressed savefile body
+func decodeSaveBody(data string) (body saveBody, err error) {
+	if data == "" {
+		err = ErrNoData
+		return
+	}
+	js, err := lzstring.DecompressBase64(data)
+	if err != nil {
+		return
+	}
+	err = decodeJsonValue([]byte(js), &body)
+	if err == nil && body == nil {
+		err = ErrNoData
+	}
+	return
+}
+
+// encode the savefile body to lzstring-compressed string, keeping the order of object members in o
+func (b saveBody) encode(o *jsonOrder) (data string, err error) {
+	js, err := encodeJsonOrdered(map[string]any(b), o)
+	if err != nil {
+		return
+	}
+	return lzstring.CompressToBase64(string(js)), nil
+}
+
+// decode the savefile body of the entry
+func (se *saveEntry) body() (saveBody, error) {
+	return decodeSaveBody(se.SaveData)
+}
+
+// encode and store the savefile body to the entry, keeping the order of object members in the current body
+func (se *saveEntry) setBody(b saveBody) (err error) {
+	var o *jsonOrder
+	if js, e := lzstring.DecompressBase64(se.SaveData); e == nil && js != "" {
+		o = readJsonOrder([]byte(js))
+	}
+	data, err := b.encode(o)
+	if err != nil {
+		return
+	}
+	se.SaveData = data
+	return
+}
+
+// get a game object in the save body, i.e. "switches", "party", "player"
+func (b saveBody) object(name string) (obj map[string]any, err error) {
+	obj = jsonExObject(b[name])
+	if obj == nil {
+		err = fmt.Errorf("%w: %s", ErrNoSaveObject, name)
+	}
+	return
+}
+
+// get the "_data" member of a game object, i.e. Game_Switches._data
+func (b saveBody) objectData(name string) (data any, err error) {
+	obj, err := b.object(name)
+	if err != nil {
+		return
+	}
+	data, ok := obj["_data"]
+	if !ok {
+		err = fmt.Errorf("%w: %s._data", ErrNoSaveObject, name)
+	}
+	return
+}
+
+// get a JsonEx object
+func jsonExObject(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+// get a JsonEx array.
+// JsonEx wraps arrays to {"@c":id, "@a":[...]} form; plain arrays are also accepted.
+func jsonExArray(v any) []any {
+	switch t := v.(type) {
+	case []any:
+		return t
+	case map[string]any:
+		a, _ := t["@a"].([]any)
+		return a
+	}
+	return nil
+}
+
+// store a JsonEx array to a member of an object, keeping the array wrapper if exists
+func jsonExSetArray(obj map[string]any, key string, a []any) {
+	if w, ok := obj[key].(map[string]any); ok {
+		if _, ok := w["@a"]; ok {
+			w["@a"] = a
+			return
+		}
+	}
+	obj[key] = a
+}
+
+// extend the array to have the index n.
+// an index beyond maxArrayIndex is refused, not to allocate a huge array for a mistyped ID
+func growArray(a []any, n int) ([]any, error) {
+	if n < 0 || (n >= len(a) && n > maxArrayIndex) {
+		return a, fmt.Errorf("%w: %d is beyond the maximum %d", ErrInvalidId, n, maxArrayIndex)
+	}
+	for len(a) <= n {
+		a = append(a, nil)
+	}
+	return a, nil
+}
+
+// get an integer value of a json value
+func jsonInt(v any) (n int, ok bool) {
+	switch t := v.(type) {
+	case json.Number:
+		i, err := t.Int64()
+		if err != nil {
+			f, err := t.Float64()
+			if err != nil {
+				return 0, false
+			}
+			return int(f), true
+		}
+		return int(i), true
+	case float64:
+		return int(t), true
+	case int:
+		return t, true
+	}
+	return 0, false
+}
+
+// make a json number from an integer
+func jsonNumber(n int) json.Number {
+	return json.Number(fmt.Sprint(n))
+}
+
+// json representation of a value, for displaying
+func jsonString(v any) string {
+	js, err := encodeJsonValue(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(js)
+}
+
+// update the index json of the entry
+func (se *saveEntry) updateIndex(fn func(ie map[string]any) error) (err error) {
+	if se.IndexJson == nil {
+		return ErrNoData
+	}
+	var ie map[string]any
+	err = decodeJsonValue(se.IndexJson, &ie)
+	if err != nil {
+		return
+	}
+	err = fn(ie)
+	if err != nil {
+		return
+	}
+	js, err := encodeJsonOrdered(ie, readJsonOrder(se.IndexJson))
+	if err != nil {
+		return
+	}
+	se.IndexJson = js
+	return
+}
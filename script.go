@@ -0,0 +1,947 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A small expression language to transform savefiles.
+//
+//	# comments start with '#' or '//'
+//	variables[5] += 1; if switches[3] { gold = gold * 2 } else { items[1] = 10 }
+//	switches["Boss defeated"] = variables["Chapter"] >= 3 && !selfswitches["3,7,A"]
+//
+// Statements are assignments (=, +=, -=, *=, /=) and if/else blocks; semicolons are optional.
+// Values are numbers, strings and booleans.
+// Game state values are:
+//
+//	switches[ID], variables[ID], selfswitches["MAPID,EVENTID,LETTER"]
+//	gold, steps
+//	items[ID], weapons[ID], armors[ID]   (number of items in the party)
+//
+// IDs may be names if the game data is available.
+
+const (
+	maxGold = 99999999 // Game_Party.maxGold()
+)
+
+var (
+	ErrScriptSyntax  = errors.New("syntax error")
+	ErrScriptRuntime = errors.New("script error")
+)
+
+//
+// lexer
+//
+
+type scriptTokenKind int
+
+const (
+	tokEOF scriptTokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokPunct
+)
+
+type scriptToken struct {
+	kind scriptTokenKind
+	text string
+	num  float64 // value of a number token
+	line int
+}
+
+// punctuations, longer ones first
+var scriptPuncts = []string{
+	"==", "!=", "<=", ">=", "&&", "||", "+=", "-=", "*=", "/=",
+	"{", "}", "(", ")", "[", "]", ";", "+", "-", "*", "/", "%", "!", "=", "<", ">",
+}
+
+// split a script into tokens
+func tokenizeScript(src string) (tokens []scriptToken, err error) {
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#' || strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			n, e := strconv.ParseFloat(src[i:j], 64)
+			if e != nil {
+				return nil, fmt.Errorf("%w: line %d: invalid number %s", ErrScriptSyntax, line, src[i:j])
+			}
+			tokens = append(tokens, scriptToken{kind: tokNumber, text: src[i:j], num: n, line: line})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("%w: line %d: unterminated string", ErrScriptSyntax, line)
+			}
+			s, e := strconv.Unquote(src[i : j+1])
+			if e != nil {
+				return nil, fmt.Errorf("%w: line %d: invalid string %s", ErrScriptSyntax, line, src[i:j+1])
+			}
+			tokens = append(tokens, scriptToken{kind: tokString, text: s, line: line})
+			i = j + 1
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, scriptToken{kind: tokIdent, text: src[i:j], line: line})
+			i = j
+		default:
+			found := false
+			for _, p := range scriptPuncts {
+				if strings.HasPrefix(src[i:], p) {
+					tokens = append(tokens, scriptToken{kind: tokPunct, text: p, line: line})
+					i += len(p)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%w: line %d: unexpected character %q", ErrScriptSyntax, line, c)
+			}
+		}
+	}
+	tokens = append(tokens, scriptToken{kind: tokEOF, line: line})
+	return
+}
+
+//
+// syntax tree
+//
+
+type scriptExpr interface {
+	eval(env *scriptEnv) (any, error)
+}
+
+type scriptStmt interface {
+	exec(env *scriptEnv) error
+}
+
+type scriptLiteral struct {
+	value any
+}
+
+// a game state value, with an optional index
+type scriptRef struct {
+	name  string
+	index scriptExpr // nil if not indexed
+	line  int
+}
+
+type scriptUnary struct {
+	op string
+	x  scriptExpr
+}
+
+type scriptBinary struct {
+	op   string
+	l, r scriptExpr
+	line int
+}
+
+type scriptAssign struct {
+	target *scriptRef
+	op     string
+	value  scriptExpr
+}
+
+type scriptIf struct {
+	cond      scriptExpr
+	then, els []scriptStmt
+}
+
+// a parsed script
+type script []scriptStmt
+
+//
+// parser
+//
+
+type scriptParser struct {
+	tokens []scriptToken
+	pos    int
+}
+
+func (p *scriptParser) peek() scriptToken {
+	return p.tokens[p.pos]
+}
+
+func (p *scriptParser) next() scriptToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// check whether the next token is a punctuation or keyword, and consume it if so
+func (p *scriptParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokPunct || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *scriptParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("%q expected", text)
+	}
+	return nil
+}
+
+func (p *scriptParser) errorf(format string, a ...any) error {
+	t := p.peek()
+	near := t.text
+	if t.kind == tokEOF {
+		near = "end of script"
+	}
+	return fmt.Errorf("%w: line %d near %s: %s", ErrScriptSyntax, t.line, near, fmt.Sprintf(format, a...))
+}
+
+// parse a script
+func parseScript(src string) (s script, err error) {
+	tokens, err := tokenizeScript(src)
+	if err != nil {
+		return
+	}
+	p := &scriptParser{tokens: tokens}
+	s, err = p.parseBlock()
+	if err != nil {
+		return
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return
+}
+
+// parse statements until '}' or the end
+func (p *scriptParser) parseBlock() (stmts []scriptStmt, err error) {
+	for {
+		for p.accept(";") {
+		}
+		t := p.peek()
+		if t.kind == tokEOF || (t.kind == tokPunct && t.text == "}") {
+			return
+		}
+		var st scriptStmt
+		st, err = p.parseStatement()
+		if err != nil {
+			return
+		}
+		stmts = append(stmts, st)
+	}
+}
+
+// parse a '{' block '}'
+func (p *scriptParser) parseBraces() (stmts []scriptStmt, err error) {
+	if err = p.expect("{"); err != nil {
+		return
+	}
+	stmts, err = p.parseBlock()
+	if err != nil {
+		return
+	}
+	err = p.expect("}")
+	return
+}
+
+func (p *scriptParser) parseStatement() (st scriptStmt, err error) {
+	if p.accept("if") {
+		s := &scriptIf{}
+		s.cond, err = p.parseExpr()
+		if err != nil {
+			return
+		}
+		s.then, err = p.parseBraces()
+		if err != nil {
+			return
+		}
+		if p.accept("else") {
+			if p.peek().text == "if" {
+				var elif scriptStmt
+				elif, err = p.parseStatement()
+				s.els = []scriptStmt{elif}
+			} else {
+				s.els, err = p.parseBraces()
+			}
+			if err != nil {
+				return
+			}
+		}
+		return s, nil
+	}
+
+	// assignment
+	if p.peek().kind != tokIdent {
+		return nil, p.errorf("statement expected")
+	}
+	x, err := p.parsePrimary()
+	if err != nil {
+		return
+	}
+	ref, ok := x.(*scriptRef)
+	if !ok {
+		return nil, p.errorf("assignment expected")
+	}
+	op := p.peek()
+	switch op.text {
+	case "=", "+=", "-=", "*=", "/=":
+		p.next()
+	default:
+		return nil, p.errorf("assignment operator expected")
+	}
+	value, err := p.parseExpr()
+	if err != nil {
+		return
+	}
+	return &scriptAssign{target: ref, op: op.text, value: value}, nil
+}
+
+// binary operator precedence levels, lowest first
+var scriptBinaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *scriptParser) parseExpr() (scriptExpr, error) {
+	return p.parseBinary(0)
+}
+
+func (p *scriptParser) parseBinary(level int) (x scriptExpr, err error) {
+	if level >= len(scriptBinaryOps) {
+		return p.parseUnary()
+	}
+	x, err = p.parseBinary(level + 1)
+	if err != nil {
+		return
+	}
+	for {
+		t := p.peek()
+		found := false
+		if t.kind == tokPunct {
+			for _, op := range scriptBinaryOps[level] {
+				if t.text == op {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return
+		}
+		p.next()
+		var r scriptExpr
+		r, err = p.parseBinary(level + 1)
+		if err != nil {
+			return
+		}
+		x = &scriptBinary{op: t.text, l: x, r: r, line: t.line}
+	}
+}
+
+func (p *scriptParser) parseUnary() (scriptExpr, error) {
+	if p.accept("-") {
+		x, err := p.parseUnary()
+		return &scriptUnary{op: "-", x: x}, err
+	}
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		return &scriptUnary{op: "!", x: x}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *scriptParser) parsePrimary() (x scriptExpr, err error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &scriptLiteral{value: t.num}, nil
+	case tokString:
+		return &scriptLiteral{value: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &scriptLiteral{value: true}, nil
+		case "false":
+			return &scriptLiteral{value: false}, nil
+		case "if", "else":
+			p.pos--
+			return nil, p.errorf("unexpected keyword")
+		}
+		ref := &scriptRef{name: strings.ToLower(t.text), line: t.line}
+		if p.accept("[") {
+			ref.index, err = p.parseExpr()
+			if err != nil {
+				return
+			}
+			if err = p.expect("]"); err != nil {
+				return
+			}
+		}
+		if err = ref.check(); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrScriptSyntax, t.line, err)
+		}
+		return ref, nil
+	case tokPunct:
+		if t.text == "(" {
+			x, err = p.parseExpr()
+			if err != nil {
+				return
+			}
+			err = p.expect(")")
+			return
+		}
+	}
+	p.pos--
+	return nil, p.errorf("expression expected")
+}
+
+//
+// evaluation
+//
+
+// a change made by a script
+type scriptChange struct {
+	key      string
+	old, new any
+}
+
+// environment to run a script on a save body
+type scriptEnv struct {
+	body saveBody
+	gd   *gameData
+
+	changes []*scriptChange
+}
+
+// run the script on a save body. returns the list of changed values.
+func (s script) run(body saveBody, gd *gameData) (changes []*scriptChange, err error) {
+	env := &scriptEnv{body: body, gd: gd}
+	err = execStatements(env, s)
+	if err != nil {
+		return
+	}
+	// drop the values that are restored to the original
+	for _, c := range env.changes {
+		if !scriptEqual(c.old, c.new) {
+			changes = append(changes, c)
+		}
+	}
+	return
+}
+
+func execStatements(env *scriptEnv, stmts []scriptStmt) error {
+	for _, st := range stmts {
+		if err := st.exec(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *scriptIf) exec(env *scriptEnv) error {
+	c, err := s.cond.eval(env)
+	if err != nil {
+		return err
+	}
+	if scriptTruthy(c) {
+		return execStatements(env, s.then)
+	}
+	return execStatements(env, s.els)
+}
+
+func (s *scriptAssign) exec(env *scriptEnv) (err error) {
+	v, err := s.value.eval(env)
+	if err != nil {
+		return
+	}
+	if s.op != "=" {
+		var old any
+		old, err = s.target.eval(env)
+		if err != nil {
+			return
+		}
+		v, err = scriptArith(s.op[:1], old, v, s.target.line)
+		if err != nil {
+			return
+		}
+	}
+	return s.target.set(env, v)
+}
+
+func (x *scriptLiteral) eval(env *scriptEnv) (any, error) {
+	return x.value, nil
+}
+
+func (x *scriptUnary) eval(env *scriptEnv) (any, error) {
+	v, err := x.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if x.op == "!" {
+		return !scriptTruthy(v), nil
+	}
+	n, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot negate %v", ErrScriptRuntime, v)
+	}
+	return -n, nil
+}
+
+func (x *scriptBinary) eval(env *scriptEnv) (any, error) {
+	l, err := x.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	// short circuit operators
+	switch x.op {
+	case "&&":
+		if !scriptTruthy(l) {
+			return false, nil
+		}
+		r, err := x.r.eval(env)
+		return scriptTruthy(r), err
+	case "||":
+		if scriptTruthy(l) {
+			return true, nil
+		}
+		r, err := x.r.eval(env)
+		return scriptTruthy(r), err
+	}
+
+	r, err := x.r.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "==":
+		return scriptEqual(l, r), nil
+	case "!=":
+		return !scriptEqual(l, r), nil
+	case "<", "<=", ">", ">=":
+		ln, lok := l.(float64)
+		rn, rok := r.(float64)
+		if !lok || !rok {
+			ls, lok := l.(string)
+			rs, rok := r.(string)
+			if !lok || !rok {
+				return nil, fmt.Errorf("%w: line %d: cannot compare %v and %v", ErrScriptRuntime, x.line, l, r)
+			}
+			c := strings.Compare(ls, rs)
+			ln, rn = float64(c), 0
+		}
+		switch x.op {
+		case "<":
+			return ln < rn, nil
+		case "<=":
+			return ln <= rn, nil
+		case ">":
+			return ln > rn, nil
+		}
+		return ln >= rn, nil
+	}
+	return scriptArith(x.op, l, r, x.line)
+}
+
+// arithmetic operations
+func scriptArith(op string, l, r any, line int) (any, error) {
+	if op == "+" {
+		// string concatenation
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok || rok {
+			if !lok {
+				ls = scriptString(l)
+			}
+			if !rok {
+				rs = scriptString(r)
+			}
+			return ls + rs, nil
+		}
+	}
+	ln, lok := l.(float64)
+	rn, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%w: line %d: invalid operands %v %s %v", ErrScriptRuntime, line, l, op, r)
+	}
+	switch op {
+	case "+":
+		return ln + rn, nil
+	case "-":
+		return ln - rn, nil
+	case "*":
+		return ln * rn, nil
+	case "/", "%":
+		if rn == 0 {
+			return nil, fmt.Errorf("%w: line %d: division by zero", ErrScriptRuntime, line)
+		}
+		if op == "/" {
+			return ln / rn, nil
+		}
+		return math.Mod(ln, rn), nil
+	}
+	return nil, fmt.Errorf("%w: line %d: unknown operator %s", ErrScriptRuntime, line, op)
+}
+
+// truthiness of a value, same as javascript
+func scriptTruthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0 && !math.IsNaN(t)
+	case string:
+		return t != ""
+	}
+	return true
+}
+
+func scriptEqual(a, b any) bool {
+	return a == b
+}
+
+// string representation of a value
+func scriptString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case string:
+		return strconv.Quote(t)
+	}
+	return fmt.Sprint(v)
+}
+
+// convert a json value in the save to a script value
+func fromJsonValue(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return nil
+		}
+		return f
+	case bool, string:
+		return t
+	}
+	return nil
+}
+
+// convert a script value to a json value to be stored in the save
+func toJsonValue(v any) any {
+	if f, ok := v.(float64); ok {
+		if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+			return jsonNumber(int(f))
+		}
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return v
+}
+
+// integer value of a script value
+func scriptInt(v any) int {
+	f, _ := v.(float64)
+	return int(math.Floor(f))
+}
+
+// game state values
+var scriptRefs = map[string]struct {
+	indexed bool
+	names   func(gd *gameData) func() ([]string, error) // name list for the index
+}{
+	"switches": {true, func(gd *gameData) func() ([]string, error) {
+		return func() ([]string, error) {
+			sys, err := gd.system()
+			if err != nil {
+				return nil, err
+			}
+			return sys.Switches, nil
+		}
+	}},
+	"variables": {true, func(gd *gameData) func() ([]string, error) {
+		return func() ([]string, error) {
+			sys, err := gd.system()
+			if err != nil {
+				return nil, err
+			}
+			return sys.Variables, nil
+		}
+	}},
+	"selfswitches": {true, nil},
+	"gold":         {false, nil},
+	"steps":        {false, nil},
+	"items":        {true, func(gd *gameData) func() ([]string, error) { return gd.dataNameList(gameDataItems) }},
+	"weapons":      {true, func(gd *gameData) func() ([]string, error) { return gd.dataNameList(gameDataWeapons) }},
+	"armors":       {true, func(gd *gameData) func() ([]string, error) { return gd.dataNameList(gameDataArmors) }},
+}
+
+// check the name and the index of the reference
+func (x *scriptRef) check() error {
+	r, ok := scriptRefs[x.name]
+	if !ok {
+		return fmt.Errorf("unknown name %s", x.name)
+	}
+	if r.indexed != (x.index != nil) {
+		if r.indexed {
+			return fmt.Errorf("%s needs an index", x.name)
+		}
+		return fmt.Errorf("%s cannot be indexed", x.name)
+	}
+	return nil
+}
+
+// evaluate the index of the reference to an ID, or a self switch key "MAPID,EVENTID,LETTER".
+// label is the name of the value to be displayed.
+func (x *scriptRef) key(env *scriptEnv) (id int, ssKey string, label string, err error) {
+	if x.index == nil {
+		return 0, "", x.name, nil
+	}
+	v, err := x.index.eval(env)
+	if err != nil {
+		return
+	}
+	if x.name == "selfswitches" {
+		s, ok := v.(string)
+		if !ok || selfSwitchMatch.FindStringSubmatch(s) == nil {
+			return 0, "", "", fmt.Errorf("%w: line %d: invalid self switch key %v", ErrScriptRuntime, x.line, v)
+		}
+		return 0, s, fmt.Sprintf("%s[%q]", x.name, s), nil
+	}
+	switch t := v.(type) {
+	case float64:
+		id = scriptInt(t)
+	case string:
+		id, err = resolveId(strconv.Quote(t), scriptRefs[x.name].names(env.gd))
+		if err != nil {
+			return
+		}
+	default:
+		return 0, "", "", fmt.Errorf("%w: line %d: invalid index %v", ErrScriptRuntime, x.line, v)
+	}
+	if id <= 0 {
+		return 0, "", "", fmt.Errorf("%w: line %d: invalid index %v", ErrScriptRuntime, x.line, v)
+	}
+	return id, "", fmt.Sprintf("%s[%d]", x.name, id), nil
+}
+
+// get the container of the reference in the save body
+func (x *scriptRef) container(env *scriptEnv) (obj map[string]any, member string, err error) {
+	switch x.name {
+	case "switches", "variables":
+		obj, err = env.body.object(x.name)
+		member = "_data"
+	case "selfswitches":
+		var o map[string]any
+		o, err = env.body.object("selfSwitches")
+		if err == nil {
+			obj = jsonExObject(o["_data"])
+			if obj == nil {
+				err = fmt.Errorf("%w: selfSwitches._data", ErrNoSaveObject)
+			}
+		}
+	case "gold", "steps":
+		obj, err = env.body.object("party")
+		member = "_" + x.name
+	case "items", "weapons", "armors":
+		var o map[string]any
+		o, err = env.body.object("party")
+		if err == nil {
+			obj = jsonExObject(o["_"+x.name])
+			if obj == nil {
+				err = fmt.Errorf("%w: party._%s", ErrNoSaveObject, x.name)
+			}
+		}
+	}
+	return
+}
+
+func (x *scriptRef) eval(env *scriptEnv) (v any, err error) {
+	id, ssKey, _, err := x.key(env)
+	if err != nil {
+		return
+	}
+	obj, member, err := x.container(env)
+	if err != nil {
+		return
+	}
+	switch x.name {
+	case "switches":
+		a := jsonExArray(obj[member])
+		return id < len(a) && a[id] == true, nil
+	case "variables":
+		a := jsonExArray(obj[member])
+		if id < len(a) && a[id] != nil {
+			return fromJsonValue(a[id]), nil
+		}
+		return float64(0), nil
+	case "selfswitches":
+		return obj[ssKey] == true, nil
+	case "gold", "steps":
+		n, _ := jsonInt(obj[member])
+		return float64(n), nil
+	default: // items, weapons, armors
+		n, _ := jsonInt(obj[strconv.Itoa(id)])
+		return float64(n), nil
+	}
+}
+
+func (x *scriptRef) set(env *scriptEnv, v any) (err error) {
+	id, ssKey, key, err := x.key(env)
+	if err != nil {
+		return
+	}
+	old, err := x.eval(env)
+	if err != nil {
+		return
+	}
+	obj, member, err := x.container(env)
+	if err != nil {
+		return
+	}
+
+	switch x.name {
+	case "switches":
+		v = scriptTruthy(v)
+		a, e := growArray(jsonExArray(obj[member]), id)
+		if e != nil {
+			return fmt.Errorf("%w: line %d: %s: %v", ErrScriptRuntime, x.line, x.name, e)
+		}
+		a[id] = v
+		jsonExSetArray(obj, member, a)
+	case "variables":
+		if f, ok := v.(float64); ok {
+			v = math.Floor(f) // Game_Variables.setValue() floors numbers
+		}
+		a, e := growArray(jsonExArray(obj[member]), id)
+		if e != nil {
+			return fmt.Errorf("%w: line %d: %s: %v", ErrScriptRuntime, x.line, x.name, e)
+		}
+		a[id] = toJsonValue(v)
+		jsonExSetArray(obj, member, a)
+	case "selfswitches":
+		v = scriptTruthy(v)
+		if v == true {
+			obj[ssKey] = true
+		} else {
+			delete(obj, ssKey)
+		}
+	case "gold", "steps", "items", "weapons", "armors":
+		f, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%w: line %d: %s must be a number", ErrScriptRuntime, x.line, key)
+		}
+		limit := math.Inf(1)
+		if x.name == "gold" {
+			limit = maxGold
+		} else if x.name != "steps" {
+			limit = maxItemCount
+		}
+		v = math.Max(0, math.Min(math.Floor(f), limit))
+		if member != "" {
+			obj[member] = toJsonValue(v)
+		} else if v == float64(0) {
+			delete(obj, strconv.Itoa(id))
+		} else {
+			obj[strconv.Itoa(id)] = toJsonValue(v)
+		}
+	}
+
+	// record the change
+	for _, c := range env.changes {
+		if c.key == key {
+			c.new = v
+			return
+		}
+	}
+	env.changes = append(env.changes, &scriptChange{key: key, old: old, new: v})
+	return
+}
+
+// run a script on savefiles
+func cmdRun(scriptFile string, src []*saveFileSelector) (err error) {
+	text, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return
+	}
+	s, err := parseScript(string(text))
+	if err != nil {
+		return fmt.Errorf("%s: %w", scriptFile, err)
+	}
+
+	total := 0
+	for _, ss := range src {
+		var entries []*saveEntry
+		entries, err = ss.readSaveAtPath(false, true)
+		if err != nil {
+			return
+		}
+		gd := openGameData(ss)
+		var count int
+		count, err = editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+			body, err := se.body()
+			if err != nil {
+				return
+			}
+			changes, err := s.run(body, gd)
+			if err != nil {
+				return
+			}
+			if len(changes) == 0 {
+				if cfg.verbose {
+					fmt.Printf("%s: no changes\n", ss.displayPath(se.Id))
+				}
+				return false, nil
+			}
+			if cfg.verbose {
+				fmt.Printf("%s:\n", ss.displayPath(se.Id))
+				for _, c := range changes {
+					fmt.Printf("  %s: %s -> %s\n", c.key, scriptString(c.old), scriptString(c.new))
+				}
+			}
+			return true, se.setBody(body)
+		})
+		if err != nil {
+			return
+		}
+		total += count
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves modified\n", total)
+	}
+	return
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMaxSavefiles = 20 // DataManager.maxSavefiles() of rpg maker mv
+
+	gameJsDir        = "js"               // script directory of the game, next to the data directory
+	gameJsPluginDir  = "plugins"          // plugin scripts in the script directory
+	gameJsPlugins    = "plugins.js"       // plugin list and parameters
+	gameJsManagersMV = "rpg_managers.js"  // core script of rpg maker mv defining DataManager
+	gameJsManagersMZ = "rmmz_managers.js" // core script of rpg maker mz
+)
+
+var (
+	maxSavefilesMatch = regexp.MustCompile(`DataManager\.maxSavefiles\s*=\s*function\s*\(\s*\)\s*\{\s*return\s+(\d+)\s*;?\s*\}`) // DataManager.maxSavefiles = function() { return 20; };
+)
+
+// normalized plugin parameter names that set the number of save slots
+var slotParamNames = map[string]bool{
+	"maxsavefiles":      true,
+	"maxsavefile":       true,
+	"maxsaveslots":      true,
+	"maxslots":          true,
+	"saveslots":         true,
+	"savefiles":         true,
+	"savefilemax":       true,
+	"numberofsaveslots": true,
+	"savefilecount":     true,
+	"saveslotcount":     true,
+}
+
+// a plugin entry of plugins.js
+type rpgPluginEntry struct {
+	Name       string         `json:"name"`
+	Status     bool           `json:"status"`
+	Parameters map[string]any `json:"parameters"` // parameter values are usually strings
+}
+
+// read the number of save slots set in a script. returns 0 if not found.
+func scriptMaxSavefiles(filename string) int {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, m := range maxSavefilesMatch.FindAllStringSubmatch(string(data), -1) {
+		n, _ = strconv.Atoi(m[1]) // the last definition wins
+	}
+	return n
+}
+
+// read the number of save slots set by plugin parameters or plugin scripts. returns 0 if not found.
+func pluginMaxSavefiles(jsDir string) (n int, source string) {
+	data, err := os.ReadFile(filepath.Join(jsDir, gameJsPlugins))
+	if err != nil {
+		return
+	}
+	// plugins.js is "var $plugins = [ ... ];"
+	s := string(data)
+	start, end := strings.Index(s, "["), strings.LastIndex(s, "]")
+	if start < 0 || end < start {
+		return
+	}
+	var plugins []*rpgPluginEntry
+	if json.Unmarshal([]byte(s[start:end+1]), &plugins) != nil {
+		return
+	}
+	normalize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' {
+				return r
+			}
+			return -1
+		}, strings.ToLower(s))
+	}
+	// plugins are loaded in order; later plugins override earlier ones
+	for _, p := range plugins {
+		if p == nil || !p.Status {
+			continue
+		}
+		for k, v := range p.Parameters {
+			if !slotParamNames[normalize(k)] {
+				continue
+			}
+			if i, e := strconv.Atoi(strings.TrimSpace(fmt.Sprint(v))); e == nil && i > 0 {
+				n, source = i, fmt.Sprintf("parameter '%s' of plugin %s", k, p.Name)
+			}
+		}
+		if i := scriptMaxSavefiles(filepath.Join(jsDir, gameJsPluginDir, p.Name+".js")); i > 0 {
+			n, source = i, fmt.Sprintf("plugin %s", p.Name)
+		}
+	}
+	return
+}
+
+// get the number of save slots shown in the game, for a rpg maker mv save directory.
+// the number is set with -slots flag, or detected from the scripts of the game.
+// returns 0 if the save is not a save directory or the game is not found.
+func (ss *saveFileSelector) maxSavefiles() (n int, source string) {
+	if cfg.maxSlots > 0 {
+		return cfg.maxSlots, "-slots flag"
+	}
+	if !ss.IsRpgMvSave {
+		return
+	}
+	dataDir := findGameDataDir(ss)
+	if dataDir == "" {
+		return
+	}
+	jsDir := filepath.Join(dataDir, "..", gameJsDir)
+	if st, err := os.Stat(jsDir); err != nil || !st.IsDir() {
+		return
+	}
+
+	n, source = defaultMaxSavefiles, "default"
+	for _, f := range []string{gameJsManagersMV, gameJsManagersMZ} {
+		if i := scriptMaxSavefiles(filepath.Join(jsDir, f)); i > 0 {
+			n, source = i, f
+		}
+	}
+	if i, s := pluginMaxSavefiles(jsDir); i > 0 {
+		n, source = i, s
+	}
+	return
+}
+
+// check whether an ID is within the save slots shown in the game.
+// writing beyond the limit is refused unless --no-slot-limit flag is set.
+func (ss *saveFileSelector) checkSlotLimit(id int, limit int, source string) error {
+	if !ss.IsRpgMvSave || limit <= 0 || id <= limit {
+		return nil
+	}
+	if !cfg.noSlotLimit {
+		return fmt.Errorf("%s is beyond the %d save slots of the game (%s); it would not be shown in the game. use --no-slot-limit to write anyway", ss.displayPath(id), limit, source)
+	}
+	fmt.Fprintf(os.Stderr, "warning: %s is beyond the %d save slots of the game (%s)\n", ss.displayPath(id), limit, source)
+	return nil
+}
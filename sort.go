@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// convert a playtime string "HH:MM:SS" to seconds. returns -1 if the string is invalid.
+func playtimeSeconds(s string) int {
+	sec := 0
+	a := strings.Split(s, ":")
+	if len(a) != 3 {
+		return -1
+	}
+	for _, v := range a {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return -1
+		}
+		sec = sec*60 + n
+	}
+	return sec
+}
+
+// sort entries by the order key given with -by flag; "id", "timestamp", "playtime" or "map".
+// the order of the key is reversed with -r flag; entries with the same key are kept in increasing ID order.
+// entries without index are placed at the end in increasing ID order.
+func sortEntriesBy(entries []*saveEntry, by string) (err error) {
+	var compare func(a, b *rpgMvSaveIndexEntry) int
+	switch by {
+	case "id":
+	case "timestamp", "time":
+		compare = func(a, b *rpgMvSaveIndexEntry) int { return compareInt(int(a.Timestamp), int(b.Timestamp)) }
+	case "playtime":
+		compare = func(a, b *rpgMvSaveIndexEntry) int {
+			return compareInt(playtimeSeconds(a.Playtime), playtimeSeconds(b.Playtime))
+		}
+	case "map":
+		compare = func(a, b *rpgMvSaveIndexEntry) int {
+			return strings.Compare(strings.ToLower(a.MapName), strings.ToLower(b.MapName))
+		}
+	default:
+		return fmt.Errorf("unknown order: %s", by)
+	}
+
+	// decode index entries once
+	index := make(map[*saveEntry]*rpgMvSaveIndexEntry)
+	for _, se := range entries {
+		if ie, e := se.indexEntry(); e == nil {
+			index[se] = ie
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := index[entries[i]], index[entries[j]]
+		c := 0
+		if compare != nil {
+			if a == nil || b == nil {
+				if (a == nil) != (b == nil) {
+					return a != nil // entries with index first
+				}
+				return entries[i].Id < entries[j].Id
+			}
+			c = compare(a, b)
+		}
+		if c == 0 {
+			// the ID is the key only when ordered by ID
+			c = compareInt(entries[i].Id, entries[j].Id)
+			if compare == nil && cfg.reverse {
+				c = -c
+			}
+		} else if cfg.reverse {
+			c = -c
+		}
+		return c < 0
+	})
+	return
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// reorder entries of a save by the -by flag, reusing the IDs of the save
+func cmdSort(ss *saveFileSelector) (err error) {
+	if cfg.orderBy == "" {
+		return fmt.Errorf("please set the order with -by=timestamp, -by=playtime or -by=map")
+	}
+
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	save := entries
+	entries = ss.selectEntries(entries)
+
+	// the selected IDs are assigned to the sorted entries in increasing order
+	newIds := make([]int, len(entries))
+	for i, se := range entries {
+		newIds[i] = se.Id
+	}
+	sort.Ints(newIds)
+	err = sortEntriesBy(entries, cfg.orderBy)
+	if err != nil {
+		return
+	}
+
+	count, err := renumberEntries(ss, save, entries, newIds)
+	if err != nil {
+		return
+	}
+	printRenumberCount(count)
+	return
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+)
+
+// get the single ID of a selector
+func (ss *saveFileSelector) singleId() (id int, err error) {
+	if len(ss.IdList) != 1 || ss.OpenStart != idNotOpenEnded || ss.Query != nil {
+		return 0, fmt.Errorf("%s: please provide a single %cid", ss.Path, idSeparator)
+	}
+	return ss.IdList[0], nil
+}
+
+// stage writing entries of a save, and removing unused savefiles of rpg maker mv save directory
+func (ss *saveFileSelector) stageEntryMap(t *fileTransaction, sm map[int]*saveEntry) (err error) {
+	save := sortedEntries(sm)
+	err = ss.stageSaveToPath(t, save, cfg.rawJson, cfg.prettyJson)
+	if err != nil {
+		return
+	}
+	if ss.IsRpgMvSave {
+		err = removeUnusedRpgMvSave(t, ss.NormalizedPath, save)
+	}
+	return
+}
+
+// exchange two entries, in one save or between two saves
+func cmdSwap(a, b *saveFileSelector) (err error) {
+	// read both saves before modifying anything. queries are resolved on reading
+	entryA, err := a.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	entryB, err := b.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	idA, err := a.singleId()
+	if err != nil {
+		return
+	}
+	idB, err := b.singleId()
+	if err != nil {
+		return
+	}
+	sameFile := a.NormalizedPath == b.NormalizedPath
+	if sameFile && idA == idB {
+		return fmt.Errorf("cannot swap an entry with itself")
+	}
+
+	mA := mkEntryMap(entryA)
+	mB := mkEntryMap(entryB)
+	if sameFile {
+		mB = mA
+	}
+	seA, okA := mA[idA]
+	seB, okB := mB[idB]
+	if !okA && !okB {
+		return fmt.Errorf("no save found at %s and %s", a.displayPath(idA), b.displayPath(idB))
+	}
+
+	// check the slots to be written
+	err = a.checkProtected(seA, "move")
+	if err != nil {
+		return
+	}
+	err = b.checkProtected(seB, "move")
+	if err != nil {
+		return
+	}
+	if okB {
+		limit, source := a.maxSavefiles()
+		err = a.checkSlotLimit(idA, limit, source)
+		if err != nil {
+			return
+		}
+	}
+	if okA {
+		limit, source := b.maxSavefiles()
+		err = b.checkSlotLimit(idB, limit, source)
+		if err != nil {
+			return
+		}
+	}
+
+	if cfg.verbose {
+		fmt.Printf("swapping %s and %s\n", a.displayPath(idA), b.displayPath(idB))
+	}
+	delete(mA, idA)
+	delete(mB, idB)
+	if okA {
+		seA.Id = idB
+		mB[idB] = seA
+	}
+	if okB {
+		seB.Id = idA
+		mA[idA] = seB
+	}
+
+	// both saves are written in one transaction
+	t := newFileTransaction()
+	defer t.discard()
+	err = b.stageEntryMap(t, mB)
+	if err != nil {
+		return
+	}
+	if !sameFile {
+		err = a.stageEntryMap(t, mA)
+		if err != nil {
+			return
+		}
+	}
+	return t.commit()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// add or remove tags of archive entries.
+// op is "add" or "remove"; with an empty op, tags are listed.
+func cmdTag(ss *saveFileSelector, op string, args []string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	if ss.IsRpgMvSave {
+		return ErrNoTag
+	}
+
+	if op == "" || op == "ls" {
+		// list tags
+		lines := make([]string, 0)
+		for _, se := range ss.selectEntries(entries) {
+			lines = append(lines, fmt.Sprintf("#%d\000%s", se.Id, strings.Join(se.Tags, ",")))
+		}
+		printAlignedLines(lines, "\000")
+		return
+	}
+
+	tags, err := parseTags(strings.Join(args, ","))
+	if err != nil {
+		return
+	}
+
+	count, err := editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+		newTags := make([]string, 0)
+		switch op {
+		case "add":
+			newTags = append(newTags, se.Tags...)
+			for _, t := range tags {
+				if !se.hasTag(t) {
+					newTags = append(newTags, t)
+					modified = true
+				}
+			}
+			sort.Strings(newTags)
+		case "remove", "rm":
+			for _, t := range se.Tags {
+				removing := false
+				for _, r := range tags {
+					if t == r {
+						removing = true
+					}
+				}
+				if removing {
+					modified = true
+				} else {
+					newTags = append(newTags, t)
+				}
+			}
+		default:
+			return false, fmt.Errorf("unknown tag operation: %s", op)
+		}
+		if !modified {
+			return
+		}
+		if cfg.verbose {
+			fmt.Printf("%s: %s\n", ss.displayPath(se.Id), strings.Join(newTags, ","))
+		}
+		if len(newTags) == 0 {
+			newTags = nil
+		}
+		se.Tags = newTags
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d entries modified\n", count)
+	}
+	return
+}
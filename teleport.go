@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// character directions, as used in Game_CharacterBase
+var directionNames = map[string]int{
+	"down":  2,
+	"left":  4,
+	"right": 6,
+	"up":    8,
+}
+
+// destination of a teleport
+type teleportDest struct {
+	mapId     int
+	x, y      int
+	direction int    // 0 to keep the current direction
+	mapName   string // name of the map to be stored in the index. empty if unknown
+}
+
+// parse teleport arguments such as `map=12 x=10 y=4 dir=down`.
+// the map may be a quoted name in MapInfos.json.
+func parseTeleportDest(args []string, gd *gameData) (d *teleportDest, err error) {
+	d = &teleportDest{mapId: -1, x: -1, y: -1}
+	for _, a := range args {
+		k, v, found := strings.Cut(a, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid argument: %s", a)
+		}
+		switch strings.ToLower(k) {
+		case "map":
+			d.mapId, err = resolveId(v, gd.dataNameList(gameDataMapInfos))
+		case "x":
+			d.x, err = strconv.Atoi(v)
+		case "y":
+			d.y, err = strconv.Atoi(v)
+		case "dir", "direction":
+			var ok bool
+			d.direction, ok = directionNames[strings.ToLower(v)]
+			if !ok {
+				d.direction, err = strconv.Atoi(v)
+				if err == nil && d.direction != 0 && directionNameOf(d.direction) == "" {
+					err = fmt.Errorf("invalid direction: %s", v)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown argument: %s", a)
+		}
+		if err != nil {
+			return
+		}
+	}
+	if d.mapId <= 0 || d.x < 0 || d.y < 0 {
+		return nil, fmt.Errorf("please provide map, x and y")
+	}
+
+	if gd != nil {
+		// validate the position with the map data
+		var m *rpgMapData
+		m, err = gd.mapData(d.mapId)
+		if err != nil {
+			return
+		}
+		if d.x >= m.Width || d.y >= m.Height {
+			return nil, fmt.Errorf("position (%d,%d) is out of the map (%dx%d)", d.x, d.y, m.Width, m.Height)
+		}
+		d.mapName, err = gd.mapName(d.mapId)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// name of a direction
+func directionNameOf(dir int) string {
+	for k, v := range directionNames {
+		if v == dir {
+			return k
+		}
+	}
+	return ""
+}
+
+// move the player in a save body.
+// the transfer is reserved, as Game_Player.reserveTransfer() does, so that the map is set up when the save is loaded.
+func (d *teleportDest) apply(b saveBody) (err error) {
+	player, err := b.object("player")
+	if err != nil {
+		return
+	}
+	gameMap, err := b.object("map")
+	if err != nil {
+		return
+	}
+
+	x, y := jsonNumber(d.x), jsonNumber(d.y)
+	player["_x"], player["_y"] = x, y
+	player["_realX"], player["_realY"] = x, y
+	if d.direction != 0 {
+		player["_direction"] = jsonNumber(d.direction)
+	}
+	gameMap["_mapId"] = jsonNumber(d.mapId)
+
+	// reserve a transfer to reload the map
+	player["_transferring"] = true
+	player["_newMapId"] = jsonNumber(d.mapId)
+	player["_newX"], player["_newY"] = x, y
+	player["_newDirection"] = jsonNumber(d.direction)
+	player["_fadeType"] = jsonNumber(0)
+	player["_needsMapReload"] = true
+	return
+}
+
+// move the player in savefiles
+func cmdTeleport(ss *saveFileSelector, args []string) (err error) {
+	entries, err := ss.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+
+	gd := openGameData(ss)
+	dest, err := parseTeleportDest(args, gd)
+	if err != nil {
+		return
+	}
+
+	count, err := editEntries(ss, entries, func(se *saveEntry) (modified bool, err error) {
+		body, err := se.body()
+		if err != nil {
+			return
+		}
+		if cfg.verbose {
+			fmt.Printf("moving the player of %s to map %d (%d,%d)\n", ss.displayPath(se.Id), dest.mapId, dest.x, dest.y)
+		}
+		err = dest.apply(body)
+		if err != nil {
+			return
+		}
+		if dest.mapName != "" {
+			err = se.updateIndex(func(ie map[string]any) error {
+				if _, ok := ie["mapname"]; ok {
+					ie["mapname"] = dest.mapName
+				}
+				return nil
+			})
+			if err != nil {
+				return
+			}
+		}
+		return true, se.setBody(body)
+	})
+	if err != nil {
+		return
+	}
+
+	if cfg.verbose {
+		fmt.Printf("%d saves modified\n", count)
+	}
+	return
+}
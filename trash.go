@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	trashFileName = "trash" + extRpgArchive // trash archive in the hidden directory next to the saves
+)
+
+var (
+	ErrTrashEmpty = errors.New("the trash is empty")
+)
+
+// an entry to be moved to the trash
+type trashItem struct {
+	dir      string // directory of the save
+	se       *saveEntry
+	explicit bool // removed by a command; otherwise an unused savefile, trashed only if its contents are not kept elsewhere
+}
+
+// get the trash archive for a directory containing saves
+func trashPath(dir string) string {
+	return filepath.Join(dir, journalDirName, trashFileName)
+}
+
+// get the directory containing a save
+func saveDir(path string, isRpgMvSave bool) string {
+	if isRpgMvSave {
+		return filepath.Clean(path)
+	}
+	return filepath.Dir(path)
+}
+
+// move an entry to the trash when the transaction is committed.
+// origin is the location of the entry, i.e. "save/file3.rpgsave" or "backup.rpgarch@3"
+func (t *fileTransaction) moveToTrash(dir, origin string, se *saveEntry, explicit bool) {
+	if abs, err := filepath.Abs(origin); err == nil {
+		origin = abs
+	}
+	e := *se
+	e.Origin = origin
+	t.trash = append(t.trash, &trashItem{dir: dir, se: &e, explicit: explicit})
+}
+
+// mark the entries written by the transaction, so unused savefiles with the same contents are not trashed
+func (t *fileTransaction) keep(save []*saveEntry) {
+	if t.kept == nil {
+		t.kept = make(map[string]bool)
+	}
+	for _, se := range save {
+		if se.SaveData != "" {
+			t.kept[se.SaveData] = true
+		}
+	}
+}
+
+// stage writing the trashed entries to the trash archives
+func (t *fileTransaction) stageTrash() (err error) {
+	now := time.Now().UnixMilli()
+	byDir := make(map[string][]*saveEntry)
+	dirs := make([]string, 0)
+	trashed := make(map[string]bool) // contents already trashed
+	for _, ti := range t.trash {
+		if ti.se.SaveData != "" {
+			if trashed[ti.se.SaveData] || (!ti.explicit && t.kept[ti.se.SaveData]) {
+				continue
+			}
+			trashed[ti.se.SaveData] = true
+		}
+		if _, ok := byDir[ti.dir]; !ok {
+			dirs = append(dirs, ti.dir)
+		}
+		ti.se.Deleted = now
+		byDir[ti.dir] = append(byDir[ti.dir], ti.se)
+	}
+	t.trash = nil
+
+	for _, dir := range dirs {
+		var ts *saveFileSelector
+		var entries []*saveEntry
+		ts, entries, err = openTrash(dir)
+		if err != nil {
+			return
+		}
+		entries = purgeTrash(entries)
+		nextId := 1
+		for _, se := range entries {
+			if se.Id >= nextId {
+				nextId = se.Id + 1
+			}
+		}
+		for _, se := range byDir[dir] {
+			if cfg.verbose {
+				fmt.Printf("moving %s to the trash\n", se.Origin)
+			}
+			se.Id = nextId
+			nextId++
+			entries = append(entries, se)
+		}
+		err = writeRpgArch(t, ts.NormalizedPath, entries, false, false)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// open the trash archive of a directory
+func openTrash(dir string) (ts *saveFileSelector, entries []*saveEntry, err error) {
+	path := trashPath(dir)
+	ts = &saveFileSelector{Path: path, NormalizedPath: path, OpenStart: 1}
+	ts.ResetId()
+	entries, err = ts.readRpgArch()
+	if errors.Is(err, os.ErrNotExist) {
+		entries, err = make([]*saveEntry, 0), nil
+	}
+	return
+}
+
+// remove entries older than -trash-days
+func purgeTrash(entries []*saveEntry) []*saveEntry {
+	if cfg.trashDays <= 0 {
+		return entries
+	}
+	limit := time.Now().AddDate(0, 0, -cfg.trashDays).UnixMilli()
+	kept := make([]*saveEntry, 0, len(entries))
+	for _, se := range entries {
+		if se.Deleted >= limit {
+			kept = append(kept, se)
+		} else if cfg.verbose {
+			fmt.Printf("purging %s deleted at %s\n", se.Origin, time.UnixMilli(se.Deleted).Format("2006-01-02 15:04"))
+		}
+	}
+	return kept
+}
+
+// list, restore or empty the trash of the directory of a save
+func cmdTrash(op string, ss *saveFileSelector, dest *saveFileSelector) (err error) {
+	path, isRpgMvSave, err := detectSaveType(ss.Path)
+	if err != nil {
+		return
+	}
+	dir := saveDir(path, isRpgMvSave)
+	ts, entries, err := openTrash(dir)
+	if err != nil {
+		return
+	}
+
+	switch op {
+	case "", "ls":
+		if len(entries) == 0 {
+			if cfg.verbose {
+				fmt.Printf("the trash is empty\n")
+			}
+			return
+		}
+		lines := []string{"id\000deleted\000savetime\000map\000origin"}
+		for _, se := range entries {
+			savetime, mapName := "", ""
+			if ie, e := se.indexEntry(); e == nil {
+				savetime, mapName = ie.timestamp().Format("2006-01-02 15:04"), ie.MapName
+			}
+			lines = append(lines, fmt.Sprintf("#%d\000%s\000%s\000%s\000%s", se.Id, time.UnixMilli(se.Deleted).Format("2006-01-02 15:04"), savetime, mapName, se.Origin))
+		}
+		printAlignedLines(lines, "\000")
+		return
+
+	case "empty":
+		if len(entries) == 0 {
+			return ErrTrashEmpty
+		}
+		kept := entries
+		if cfg.trashDays > 0 {
+			kept = purgeTrash(entries)
+		} else {
+			kept = make([]*saveEntry, 0)
+		}
+		t := newFileTransaction()
+		t.noJournal = true // the trash is not a save
+		defer t.discard()
+		if len(kept) == 0 {
+			t.removeFile(ts.NormalizedPath)
+		} else {
+			err = writeRpgArch(t, ts.NormalizedPath, kept, false, false)
+			if err != nil {
+				return
+			}
+		}
+		err = t.commit()
+		if err == nil && cfg.verbose {
+			fmt.Printf("%d saves purged from the trash\n", len(entries)-len(kept))
+		}
+		return
+
+	case "restore":
+		if ss.Query != nil {
+			// the query selects entries in the trash, not in the saves
+			ids, openStart, e := ss.Query.resolve(entries, false)
+			if e != nil {
+				return fmt.Errorf("trash%c%s: %w", idSeparator, ss.Query, e)
+			}
+			ss.IdList, ss.OpenStart, ss.Query = ids, openStart, nil
+			ss.ResetId()
+		}
+		return restoreTrash(ss, ts, entries, dest)
+	}
+	return fmt.Errorf("unknown trash operation: %s", op)
+}
+
+// restore entries of the trash to the original locations, or to the destination if given
+func restoreTrash(ss *saveFileSelector, ts *saveFileSelector, entries []*saveEntry, dest *saveFileSelector) (err error) {
+	if len(entries) == 0 {
+		return ErrTrashEmpty
+	}
+
+	type restoreDest struct {
+		ss *saveFileSelector
+		m  map[int]*saveEntry
+	}
+	dests := make(map[string]*restoreDest)
+	order := make([]string, 0)
+	openDest := func(d *saveFileSelector) (rd *restoreDest, err error) {
+		save, e := d.readSaveAtPath(false, true)
+		if e != nil && !errors.Is(e, os.ErrNotExist) {
+			return nil, e
+		}
+		if rd = dests[d.NormalizedPath]; rd == nil {
+			rd = &restoreDest{ss: d, m: mkEntryMap(save)}
+			dests[d.NormalizedPath] = rd
+			order = append(order, d.NormalizedPath)
+		}
+		return
+	}
+	if dest != nil {
+		dest.ResetId()
+	}
+
+	trashM := mkEntryMap(entries)
+	count := 0
+	type renamed struct {
+		rd *restoreDest
+		se *saveEntry
+		id int // the conflicting ID
+	}
+	renames := make([]renamed, 0) // entries placed in free slots after the others
+	restore := func(rd *restoreDest, se *saveEntry, id int) {
+		if rd.ss.IsRpgMvSave && se.IndexJson == nil {
+			fmt.Fprintf(os.Stderr, "warning: trash#%d has no index; it will not be shown in the game\n", se.Id)
+		}
+		if cfg.verbose {
+			fmt.Printf("restoring trash#%d to %s\n", se.Id, rd.ss.displayPath(id))
+		}
+		delete(trashM, se.Id)
+		restored := *se
+		restored.Id, restored.Origin, restored.Deleted = id, "", 0
+		rd.m[id] = &restored
+		count++
+	}
+	for _, se := range ss.orderEntries(ss.selectEntries(entries)) {
+		var rd *restoreDest
+		var id int
+		if dest != nil {
+			rd, err = openDest(dest)
+			if err != nil {
+				return
+			}
+			var ok bool
+			id, ok = dest.NextId()
+			if !ok {
+				return fmt.Errorf("too many entries to restore")
+			}
+		} else {
+			// the original location
+			var o *saveFileSelector
+			o, err = NewSaveFileSelector(se.Origin)
+			if err != nil {
+				return
+			}
+			if len(o.IdList) != 1 {
+				return fmt.Errorf("#%d: unknown original location: %s", se.Id, se.Origin)
+			}
+			id = o.IdList[0]
+			rd, err = openDest(o)
+			if err != nil {
+				return
+			}
+		}
+		if existing, exists := rd.m[id]; exists {
+			var newId int
+			var write bool
+			newId, write, err = resolveConflict(rd.ss, id, existing, se, fmt.Sprintf("trash#%d", se.Id))
+			if err != nil {
+				return
+			}
+			if !write {
+				continue
+			}
+			if newId == idFreeSlot {
+				renames = append(renames, renamed{rd, se, id})
+				continue
+			}
+		}
+		restore(rd, se, id)
+	}
+	for _, r := range renames {
+		rd := r.rd
+		restore(rd, r.se, nextFreeId(r.id, func(id int) bool {
+			_, used := rd.m[id]
+			return used
+		}))
+	}
+	if count == 0 {
+		if cfg.verbose {
+			fmt.Printf("no saves restored\n")
+		}
+		return
+	}
+
+	t := newFileTransaction()
+	defer t.discard()
+	for _, p := range order {
+		rd := dests[p]
+		err = rd.ss.stageSaveToPath(t, sortedEntries(rd.m), cfg.rawJson, cfg.prettyJson)
+		if err != nil {
+			return
+		}
+	}
+	err = writeRpgArch(t, ts.NormalizedPath, sortedEntries(trashM), false, false)
+	if err != nil {
+		return
+	}
+	err = t.commit()
+	if err == nil && cfg.verbose {
+		fmt.Printf("%d saves restored\n", count)
+	}
+	return
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var (
+	leftoverMatch = regexp.MustCompile(`^\.(.+)\.(tmp|bak)-\d+$`) // .FILENAME.tmp-RANDOM, .FILENAME.bak-RANDOM
+)
+
+// files checked for temporary files and backups left by an interrupted command
+var checkedFiles = make(map[string]bool)
+
+// A set of file writes and removals applied all together.
+// New contents are staged to temporary files in the same directory, and renamed over the targets on commit.
+// Replaced and removed files are linked or copied to backups before that, and kept until all files are in place,
+// so the files are restored if any of the operations fails.
+type fileTransaction struct {
+	ops []*fileOp
+
+	trash []*trashItem    // entries to be moved to the trash
+	kept  map[string]bool // contents of savefiles written by the transaction
+
+	noJournal bool // do not record the previous state of the files to the journal
+}
+
+// a staged operation on a file
+type fileOp struct {
+	target string // the file to be written or removed
+	remove bool   // remove the file
+	temp   string // staged contents. empty in dry-run mode
+	perm   os.FileMode
+
+	data   []byte                  // the staged contents, kept to verify and rewrite the file
+	verify func(data []byte) error // check the contents read back after the commit. nil to skip
+
+	backup string // a link to or a copy of the original file, made while committing
+	placed bool   // the staged file is renamed to the target
+}
+
+func newFileTransaction() *fileTransaction {
+	return &fileTransaction{}
+}
+
+// find the staged operation of a file
+func (t *fileTransaction) find(filename string) *fileOp {
+	for _, op := range t.ops {
+		if op.target == filename {
+			return op
+		}
+	}
+	return nil
+}
+
+// add an operation. a later operation on the same file replaces the earlier one
+func (t *fileTransaction) add(op *fileOp) {
+	if old := t.find(op.target); old != nil {
+		if old.temp != "" {
+			os.Remove(old.temp)
+		}
+		*old = *op
+		return
+	}
+	t.ops = append(t.ops, op)
+}
+
+// stage the contents of a file
+func (t *fileTransaction) writeFile(filename string, data []byte, perm os.FileMode) (err error) {
+	if cfg.dryRun {
+		// record the operation only
+		t.add(&fileOp{target: filename, perm: perm})
+		return nil
+	}
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	checkLeftovers(filename)
+	f, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return
+	}
+	temp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(temp)
+		return
+	}
+	t.add(&fileOp{target: filename, temp: temp, perm: perm, data: data})
+	return nil
+}
+
+// stage the removal of a file
+func (t *fileTransaction) removeFile(filename string) {
+	t.add(&fileOp{target: filename, remove: true})
+}
+
+// apply all operations in the staged order.
+// if any of them fails, the files are restored to the state before the commit.
+// the previous state of the files is recorded to the journal to be undone later.
+func (t *fileTransaction) commit() (err error) {
+	if len(t.trash) > 0 {
+		err = t.stageTrash()
+		if err != nil {
+			t.discard()
+			return
+		}
+	}
+	if cfg.dryRun {
+		// show the plan without touching files
+		t.printPlan()
+		t.discard()
+		return nil
+	}
+	var journal []string
+	if !t.noJournal {
+		journal, err = t.recordJournal()
+		if err != nil {
+			t.discard()
+			return
+		}
+	}
+	for _, op := range t.ops {
+		err = op.apply()
+		if err != nil {
+			t.rollback()
+			removeAll(journal) // nothing has been changed
+			return
+		}
+	}
+	t.syncDirs()
+	err = t.verify()
+	if err != nil {
+		t.rollback()
+		removeAll(journal)
+		return
+	}
+	// all files are in place; drop the backups
+	for _, op := range t.ops {
+		if op.backup != "" {
+			os.Remove(op.backup)
+		}
+	}
+	t.ops = nil
+	return nil
+}
+
+// apply an operation, keeping the original file as a backup.
+// the staged file is renamed over the target, so the target is never missing
+func (op *fileOp) apply() (err error) {
+	if _, e := os.Lstat(op.target); e == nil {
+		dir, base := filepath.Split(op.target)
+		if dir == "" {
+			dir = "."
+		}
+		op.backup, err = backupFile(op.target, filepath.Join(dir, "."+base+".bak-*"))
+		if err != nil {
+			return
+		}
+	}
+	if op.remove {
+		err = os.Remove(op.target)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	err = os.Chmod(op.temp, op.perm)
+	if err != nil {
+		return
+	}
+	err = os.Rename(op.temp, op.target)
+	if err != nil {
+		return
+	}
+	op.placed = true
+	return nil
+}
+
+// make a backup of a file with a hard link, or a copy if the link cannot be made.
+// pattern is the backup filename with a "*" replaced by a random string
+func backupFile(filename, pattern string) (backup string, err error) {
+	f, err := os.CreateTemp(filepath.Dir(pattern), filepath.Base(pattern))
+	if err != nil {
+		return
+	}
+	backup = f.Name()
+	f.Close()
+	os.Remove(backup)
+	if os.Link(filename, backup) == nil {
+		return
+	}
+
+	// copy the file
+	src, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	st, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	dest, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, st.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dest, src)
+	if err == nil {
+		err = dest.Sync()
+	}
+	if e := dest.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(backup)
+		return "", err
+	}
+	return
+}
+
+// flush the renames of the applied operations to the disk.
+// errors are ignored, as a directory cannot be synced on some systems
+func (t *fileTransaction) syncDirs() {
+	synced := make(map[string]bool)
+	for _, op := range t.ops {
+		dir := filepath.Dir(op.target)
+		if synced[dir] {
+			continue
+		}
+		synced[dir] = true
+		if f, err := os.Open(dir); err == nil {
+			f.Sync()
+			f.Close()
+		}
+	}
+}
+
+// undo applied operations in the reverse order, and remove staged files
+func (t *fileTransaction) rollback() {
+	for i := len(t.ops) - 1; i >= 0; i-- {
+		op := t.ops[i]
+		if op.backup != "" {
+			// the backup has the original contents whether the operation is applied or not
+			os.Rename(op.backup, op.target)
+			op.backup = ""
+		} else if op.placed {
+			os.Remove(op.target)
+		}
+		op.placed = false
+	}
+	t.discard()
+}
+
+// check the temporary files and backups of a file left by an interrupted command.
+// temporary files are removed only while the directory is locked by this process, since another command may be writing them.
+// a backup is left only if the command was interrupted while committing, so it is not restored automatically
+func checkLeftovers(filename string) {
+	if checkedFiles[filename] {
+		return
+	}
+	checkedFiles[filename] = true
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	fl, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	locked := holdsLock(filename)
+	for _, f := range fl {
+		m := leftoverMatch.FindStringSubmatch(f.Name())
+		if m == nil || m[1] != base || f.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		if m[2] == "tmp" {
+			if !locked {
+				fmt.Fprintf(os.Stderr, "warning: %s may be left by an interrupted command. remove it if no other rpgmv-savetool is running\n", path)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "warning: removing %s left by an interrupted command\n", path)
+			os.Remove(path)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s is a backup left by an interrupted command. rename it to %s to restore the file, or remove it\n", path, m[1])
+	}
+}
+
+// remove staged files without applying them. does nothing after commit
+func (t *fileTransaction) discard() {
+	for _, op := range t.ops {
+		if op.temp != "" && !op.placed {
+			os.Remove(op.temp)
+		}
+	}
+	t.ops = nil
+}
+
+// print the operations of the transaction
+func (t *fileTransaction) printPlan() {
+	if len(t.ops) == 0 {
+		fmt.Printf("dry run: no files would be changed\n")
+		return
+	}
+	lines := make([]string, 0, len(t.ops))
+	for _, op := range t.ops {
+		_, e := os.Lstat(op.target)
+		exists := e == nil
+		switch {
+		case op.remove && !exists:
+			continue
+		case op.remove:
+			lines = append(lines, "remove\000"+op.target)
+		case exists:
+			lines = append(lines, "replace\000"+op.target)
+		default:
+			lines = append(lines, "create\000"+op.target)
+		}
+	}
+	fmt.Printf("dry run: files to be changed\n")
+	printAlignedLines(lines, "\000")
+}
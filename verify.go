@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	lzstring "github.com/mixcode/golib-lzstring"
+)
+
+var (
+	ErrVerify = errors.New("the written file does not match")
+)
+
+// whether to read back written files; on by default for rpg maker mv save directories
+func verifyWrites(isRpgMvSave bool) bool {
+	if cfg.setVerify {
+		return cfg.verify
+	}
+	return isRpgMvSave
+}
+
+// set a function to check the contents of a staged file after the commit
+func (t *fileTransaction) verifyWith(filename string, fn func(data []byte) error) {
+	if op := t.find(filename); op != nil && !op.remove && !cfg.dryRun {
+		op.verify = fn
+	}
+}
+
+// read back the written files and check them.
+// a mismatched file is restored from the staged copy, and checked again.
+// an error is returned if it still does not match, and the caller rolls back all files to the state before the commit.
+// the files are flushed to the disk before reading, but the contents may be read from the cache of the os,
+// so errors of the drive are not always detected.
+func (t *fileTransaction) verify() (err error) {
+	check := func(op *fileOp) error {
+		data, err := os.ReadFile(op.target)
+		if err != nil {
+			return err
+		}
+		return op.verify(data)
+	}
+	for _, op := range t.ops {
+		if op.verify == nil || !op.placed {
+			continue
+		}
+		e := check(op)
+		if e == nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "warning: verification failed: %s: %v; restoring the file from the staged copy\n", op.target, e)
+		e = rewriteFile(op.target, op.data)
+		if e == nil {
+			e = check(op)
+		}
+		if e != nil {
+			return fmt.Errorf("%w: %s: %v. all files are rolled back to the state before the command", ErrVerify, op.target, e)
+		}
+	}
+	return nil
+}
+
+// write the contents directly to the file, and flush it to the disk
+func rewriteFile(filename string, data []byte) (err error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+// compare two json texts by their values
+func jsonTextEqual(a, b []byte) bool {
+	var va, vb any
+	if decodeJsonValue(a, &va) != nil || decodeJsonValue(b, &vb) != nil {
+		return false
+	}
+	return jsonEqual(va, vb)
+}
+
+// check a written global.rpgsave has the index json
+func verifyRpgMvIndex(data []byte, indexJson []byte) (err error) {
+	js, err := lzstring.DecompressBase64(string(data))
+	if err != nil {
+		return
+	}
+	if !jsonTextEqual([]byte(js), indexJson) {
+		return fmt.Errorf("the index differs")
+	}
+	return nil
+}
+
+// check a written save body can be decoded. a body which could not be decoded before writing is not checked
+func verifySaveBody(data, staged string) (err error) {
+	if _, e := decodeSaveBody(staged); e != nil {
+		return nil
+	}
+	_, err = decodeSaveBody(data)
+	return
+}
+
+// check a written archive has the indices of the entries, and the save bodies can be decoded
+func verifyRpgArch(data []byte, save []*saveEntry) (err error) {
+	var arch []*archEntry
+	err = json.Unmarshal(data, &arch)
+	if err != nil {
+		return
+	}
+	if len(arch) != len(save) {
+		return fmt.Errorf("%d entries written, but %d entries read", len(save), len(arch))
+	}
+	for i, en := range arch {
+		se, want := en.saveEntry(), save[i]
+		if se.Id != want.Id {
+			return fmt.Errorf("entry #%d is read as #%d", want.Id, se.Id)
+		}
+		if (se.IndexJson == nil) != (want.IndexJson == nil) || (se.IndexJson != nil && !jsonTextEqual(se.IndexJson, want.IndexJson)) {
+			return fmt.Errorf("the index of #%d differs", se.Id)
+		}
+		err = verifySaveBody(se.SaveData, want.SaveData)
+		if err != nil {
+			return fmt.Errorf("cannot decode the save #%d: %w", se.Id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultWatchInterval = 2 * time.Second // polling interval of the watch command
+)
+
+// size and modification time of a savefile
+type fileState struct {
+	size  int64
+	mtime time.Time
+}
+
+// get the states of savefiles in a rpg maker mv save directory
+func savefileStates(dir string) (states map[int]fileState, err error) {
+	fl, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	states = make(map[int]fileState)
+	for _, f := range fl {
+		m := saveFileMatch.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		info, e := f.Info()
+		if e != nil {
+			continue
+		}
+		states[id] = fileState{size: info.Size(), mtime: info.ModTime()}
+	}
+	return
+}
+
+// copy savefiles of the IDs to the end of the archive, skipping bodies already in the archive.
+// returns the IDs processed. an ID not in the index yet is left to be retried
+func snapshotSaves(src, dest *saveFileSelector, ids []int) (done []int, err error) {
+	entries, err := src.readSaveAtPath(false, true)
+	if err != nil {
+		return
+	}
+	srcM := mkEntryMap(entries)
+	archive, err := dest.readSaveAtPath(false, true)
+	if errors.Is(err, os.ErrNotExist) {
+		archive, err = make([]*saveEntry, 0), nil
+	}
+	if err != nil {
+		return
+	}
+
+	bodies := make(map[string]bool)
+	nextId := 1
+	for _, se := range archive {
+		bodies[se.SaveData] = true
+		if se.Id >= nextId {
+			nextId = se.Id + 1
+		}
+	}
+	now := time.Now()
+	count := 0
+	for _, id := range ids {
+		se, ok := srcM[id]
+		if !ok || se.SaveData == "" {
+			continue
+		}
+		done = append(done, id)
+		name := filepath.Base(rpgMvSaveFilename("", id))
+		if bodies[se.SaveData] {
+			if cfg.verbose {
+				fmt.Printf("%s is already in %s\n", name, dest.Path)
+			}
+			continue
+		}
+		snap := *se
+		snap.Id, snap.Protected = nextId, false
+		snap.Comment = fmt.Sprintf("%s at %s", name, now.Format("2006-01-02 15:04:05"))
+		stampComment(&snap)
+		if cfg.verbose {
+			fmt.Printf("%s: copying %s to %s\n", now.Format("15:04:05"), name, dest.displayPath(snap.Id))
+		}
+		bodies[snap.SaveData] = true
+		archive = append(archive, &snap)
+		nextId++
+		count++
+	}
+	if count == 0 {
+		return
+	}
+	// snapshots are not recorded to the journal; it would be filled with them and lose the records of other commands
+	t := newFileTransaction()
+	t.noJournal = true
+	defer t.discard()
+	err = dest.stageSaveToPath(t, archive, cfg.rawJson, cfg.prettyJson)
+	if err != nil {
+		return
+	}
+	err = t.commit()
+	return
+}
+
+// states of savefiles seen by the watch command
+type watchState struct {
+	copied  map[int]fileState // states of savefiles already copied
+	pending map[int]fileState // changed savefiles, copied when unchanged for an interval
+}
+
+func newWatchState() *watchState {
+	return &watchState{copied: make(map[int]fileState), pending: make(map[int]fileState)}
+}
+
+// update with the current states of savefiles, and returns the IDs of savefiles the game has finished writing
+func (w *watchState) update(states map[int]fileState) (ready []int) {
+	ready = make([]int, 0)
+	for id, st := range states {
+		if c, ok := w.copied[id]; ok && c == st {
+			continue
+		}
+		if p, ok := w.pending[id]; ok && p == st {
+			// the game has finished writing
+			ready = append(ready, id)
+			continue
+		}
+		w.pending[id] = st
+	}
+	for id := range w.copied {
+		if _, ok := states[id]; !ok {
+			delete(w.copied, id) // removed by the game
+		}
+	}
+	sort.Ints(ready)
+	return
+}
+
+// mark savefiles copied to the archive
+func (w *watchState) markCopied(ids []int) {
+	for _, id := range ids {
+		w.copied[id] = w.pending[id]
+		delete(w.pending, id)
+	}
+}
+
+// copy savefiles to an archive whenever the game writes them, until interrupted
+func cmdWatch(src, dest *saveFileSelector) (err error) {
+	path, isRpgMvSave, err := detectSaveType(src.Path)
+	if err != nil {
+		return
+	}
+	if !isRpgMvSave {
+		return fmt.Errorf("%s is not a save directory", src.Path)
+	}
+	if len(src.IdList) > 0 || src.OpenStart > 1 || src.Query != nil || len(dest.IdList) > 0 || dest.OpenStart > 1 || dest.Query != nil {
+		return fmt.Errorf("watch cannot take %cid; all savefiles are copied to the end of the archive", idSeparator)
+	}
+	_, destIsDir, err := detectSaveType(dest.Path)
+	if err != nil {
+		return
+	}
+	if destIsDir {
+		return fmt.Errorf("%s is not an archive file", dest.Path)
+	}
+	// the save directory is written by the game; only the archive is locked
+	err = dest.lock()
+	if err != nil {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if cfg.verbose {
+		fmt.Printf("watching %s (press Ctrl-C to stop)\n", path)
+	}
+
+	w := newWatchState()
+	for {
+		states, e := savefileStates(path)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", e)
+		}
+		ready := w.update(states)
+		if len(ready) > 0 {
+			done, e := snapshotSaves(src, dest, ready)
+			if e != nil {
+				// retried in the next interval
+				fmt.Fprintf(os.Stderr, "warning: %v\n", e)
+				done = nil
+			}
+			w.markCopied(done)
+		}
+
+		select {
+		case <-ctx.Done():
+			if cfg.verbose {
+				fmt.Printf("stopped watching %s\n", path)
+			}
+			return nil
+		case <-time.After(cfg.watchInterval):
+		}
+	}
+}